@@ -0,0 +1,92 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"go.uber.org/zap"
+)
+
+//accessEntry access log entry
+type accessEntry struct {
+	req       *http.Request
+	pattern   string
+	status    int
+	size      int64
+	start     time.Time
+	ip        string
+	requestID string
+	user      interface{}
+}
+
+//logAccess write the access log of the request handled by ctx
+func (r *Route) logAccess(ctx *Context, start time.Time) {
+	e := &accessEntry{req: ctx.Request, pattern: r.Pattern, status: ctx.writer.Status(), size: ctx.writer.Size(), start: start}
+	if !e.skip() {
+		e.ip = ctx.ClientIP()
+		e.requestID = ctx.RequestID()
+		e.user = ctx.User()
+		e.write()
+	}
+}
+
+//logAccessStatus write the access log of the request rejected before the handler
+func (r *Route) logAccessStatus(req *http.Request, status int, start time.Time) {
+	e := &accessEntry{req: req, pattern: r.Pattern, status: status, start: start}
+	if !e.skip() {
+		e.ip = clientIP(req)
+		e.write()
+	}
+}
+
+//skip returns true if the entry is disabled,excluded or not sampled
+func (e *accessEntry) skip() bool {
+	conf := logs.AccessConf()
+	if conf == nil {
+		return false
+	}
+	if conf.Disable {
+		return true
+	}
+	path := e.req.URL.Path
+	for _, p := range conf.ExcludePaths {
+		if p == path || (strings.HasSuffix(p, "*") && strings.HasPrefix(path, p[:len(p)-1])) {
+			return true
+		}
+	}
+	if e.status < 400 && conf.SampleRate > 0 && conf.SampleRate < 1 {
+		return rand.Float64() >= conf.SampleRate
+	}
+	return false
+}
+
+func (e *accessEntry) write() {
+	status := e.status
+	if status == 0 {
+		//nothing written,net/http replies 200
+		status = http.StatusOK
+	}
+	fields := []zap.Field{
+		zap.String("method", e.req.Method),
+		zap.String("pattern", e.pattern),
+		zap.String("path", e.req.URL.Path),
+		zap.Int("status", status),
+		zap.Int64("bytes", e.size),
+		zap.Duration("latency", time.Since(e.start)),
+		zap.String("ip", e.ip),
+		zap.String("userAgent", e.req.UserAgent()),
+	}
+	if e.requestID != "" {
+		fields = append(fields, zap.String("requestId", e.requestID))
+	}
+	if e.user != nil {
+		fields = append(fields, zap.String("user", fmt.Sprint(e.user)))
+	}
+	logs.Access("access", fields...)
+}
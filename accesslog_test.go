@@ -0,0 +1,126 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//readAccessLog returns the entries of the access log file
+func readAccessLog(t *testing.T, path string) []map[string]interface{} {
+	logs.Sync()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []map[string]interface{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		e := map[string]interface{}{}
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAccessLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	setTestLog(t, &logs.LogConf{OutPath: filepath.Join(dir, "app.log"), Access: &logs.AccessLogConf{
+		OutPath:      path,
+		ExcludePaths: []string{"/health", "/static/*"},
+	}})
+	r := newTestRoute(func(ctx *Context) {
+		ctx.Set(UserKey, "u1")
+		ctx.JSON("ok")
+	}, RequestID())
+	r.MaxBodyBytes(4)
+	srv := serveRoute(t, r)
+	send := func(method, path, body string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("X-Real-IP", "10.1.1.1")
+		req.Header.Set("User-Agent", "access-test")
+		req.Header.Set(RequestIDHeader, "rid-1")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	send("GET", "/test", "")
+	send("GET", "/health", "")
+	send("GET", "/static/a.js", "")
+	send("POST", "/test", "too large")
+
+	entries := readAccessLog(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("entries=%v", entries)
+	}
+	want := []map[string]interface{}{
+		{"method": "GET", "pattern": "/test", "path": "/test", "status": 200.0, "ip": "10.1.1.1",
+			"userAgent": "access-test", "requestId": "rid-1", "user": "u1"},
+		//rejected before the handler
+		{"method": "POST", "pattern": "/test", "path": "/test", "status": 413.0, "ip": "10.1.1.1", "userAgent": "access-test"},
+	}
+	for i, w := range want {
+		e := entries[i]
+		for k, v := range w {
+			if e[k] != v {
+				t.Errorf("%d %s=%v,want %v", i, k, e[k], v)
+			}
+		}
+		if _, ok := e["latency"]; !ok {
+			t.Errorf("%d no latency", i)
+		}
+	}
+	if entries[0]["bytes"].(float64) <= 0 {
+		t.Error("no bytes of the response")
+	}
+	if _, ok := entries[1]["requestId"]; ok {
+		t.Error("the rejected request has a request id")
+	}
+}
+
+func TestAccessLogSample(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	setTestLog(t, &logs.LogConf{OutPath: filepath.Join(dir, "app.log"), Access: &logs.AccessLogConf{
+		OutPath:    path,
+		SampleRate: 1e-9,
+	}})
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		if ctx.GetString("fail") != "" {
+			ctx.FailResultWithStatus(http.StatusBadRequest, "bad", SerError)
+			return
+		}
+		ctx.JSON("ok")
+	}))
+	for i := 0; i < 10; i++ {
+		res, err := http.Get(srv.URL + "/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	res, err := http.Get(srv.URL + "/test?fail=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	//the failed requests are always logged
+	entries := readAccessLog(t, path)
+	if len(entries) != 1 || entries[0]["status"] != 400.0 {
+		t.Fatalf("entries=%v", entries)
+	}
+}
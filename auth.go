@@ -0,0 +1,122 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//PermissionsKey the request store key of the current principal's permissions,
+//set it in an authentication middleware to grant permissions without JWT
+const PermissionsKey = "bast.permissions"
+
+//Authorizer resolve the permissions of the current principal
+type Authorizer interface {
+	//Permissions returns the granted permissions,
+	//nil with a nil error means the request is not authenticated
+	Permissions(ctx *Context) ([]string, error)
+}
+
+//AuthorizerFunc adapts the function to Authorizer
+type AuthorizerFunc func(ctx *Context) ([]string, error)
+
+//Permissions call f(ctx)
+func (f AuthorizerFunc) Permissions(ctx *Context) ([]string, error) {
+	return f(ctx)
+}
+
+//SetAuthorizer set the authorizer of routes with required permissions,
+//default resolves PermissionsKey of the request store,then the permissions and scope claims of JWT
+func SetAuthorizer(a Authorizer) {
+	app.authorizer = a
+}
+
+//defaultAuthorizer resolve the permissions from the request store
+func defaultAuthorizer(ctx *Context) ([]string, error) {
+	if v, ok := ctx.Get(PermissionsKey); ok {
+		ps, _ := v.([]string)
+		if ps == nil {
+			ps = []string{}
+		}
+		return ps, nil
+	}
+	claims := ctx.Claims()
+	if claims == nil {
+		return nil, nil
+	}
+	ps := claims.Strings("permissions")
+	ps = append(ps, strings.Fields(claims.String("scope"))...)
+	for _, role := range claims.Strings("roles") {
+		ps = append(ps, "role:"+role)
+	}
+	if ps == nil {
+		ps = []string{}
+	}
+	return ps, nil
+}
+
+//Require add the permissions required by the route,all of them must be granted,
+//a granted "*" matches any permission and "users:*" matches "users:read"
+//	bast.Get("/admin/users", listUsers).Use(bast.JWTAuth()).Require("users:read")
+func (r *Route) Require(permissions ...string) *Route {
+	r.permissions = append(r.permissions, permissions...)
+	return r
+}
+
+//requiredPermissions returns the permissions of the group and the route
+func (r *Route) requiredPermissions() []string {
+	var ps []string
+	if r.group != nil {
+		ps = append(ps, r.group.allPermissions()...)
+	}
+	return append(ps, r.permissions...)
+}
+
+//authorize check the required permissions,
+//replies SerInvalidUserAuthorize(401) if not authenticated or SerPermissionDenied(403)
+func (r *Route) authorize(ctx *Context) bool {
+	required := r.requiredPermissions()
+	if len(required) == 0 {
+		return true
+	}
+	var granted []string
+	var err error
+	if app.authorizer != nil {
+		granted, err = app.authorizer.Permissions(ctx)
+	} else {
+		granted, err = defaultAuthorizer(ctx)
+	}
+	if err != nil {
+		logs.Error("authorize error,uri=" + ctx.Request.RequestURI + ",error=" + err.Error())
+		ctx.FailResultWithStatus(http.StatusForbidden, "权限验证失败", SerPermissionDenied)
+		return false
+	}
+	if granted == nil {
+		ctx.FailResultWithStatus(http.StatusUnauthorized, "用户未认证", SerInvalidUserAuthorize)
+		return false
+	}
+	for _, p := range required {
+		if !permitted(granted, p) {
+			logs.Info("permission denied,pattern=" + r.Pattern + ",require=" + p)
+			ctx.FailResultWithStatus(http.StatusForbidden, "没有访问权限："+p, SerPermissionDenied)
+			return false
+		}
+	}
+	return true
+}
+
+//permitted returns true if the required permission is granted
+func permitted(granted []string, required string) bool {
+	for _, g := range granted {
+		if g == required || g == "*" {
+			return true
+		}
+		if strings.HasSuffix(g, ":*") && strings.HasPrefix(required, g[:len(g)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//grantHeader grant the permissions of the X-Grant header,
+//no header means the request is not authenticated
+func grantHeader(ctx *Context, next func(ctx *Context)) {
+	if g, ok := ctx.Request.Header["X-Grant"]; ok {
+		ctx.Set(PermissionsKey, strings.Split(g[0], ","))
+	}
+	next(ctx)
+}
+
+//authGet send a GET request with the granted permissions,returns the status and the fail code
+func authGet(t *testing.T, url string, grant *string) (int, int) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if grant != nil {
+		req.Header.Set("X-Grant", *grant)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	msg := &Msgs{}
+	json.NewDecoder(res.Body).Decode(msg)
+	return res.StatusCode, msg.Code
+}
+
+func grants(s string) *string {
+	return &s
+}
+
+func TestRequire(t *testing.T) {
+	r := newTestRoute(func(ctx *Context) { ctx.SayStr("ok") }, grantHeader).Require("users:read", "audit")
+	srv := serveRoute(t, r)
+	tests := []struct {
+		name   string
+		grant  *string
+		status int
+		code   int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized, SerInvalidUserAuthorize},
+		{"none granted", grants(""), http.StatusForbidden, SerPermissionDenied},
+		{"partly granted", grants("users:read"), http.StatusForbidden, SerPermissionDenied},
+		{"all granted", grants("users:read,audit"), http.StatusOK, 0},
+		{"wildcard", grants("users:*,audit"), http.StatusOK, 0},
+		{"other wildcard", grants("orders:*,audit"), http.StatusForbidden, SerPermissionDenied},
+		{"any", grants("*"), http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		status, code := authGet(t, srv.URL+"/test", tt.grant)
+		if status != tt.status || code != tt.code {
+			t.Errorf("%s: status=%d code=%d,want %d %d", tt.name, status, code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestAuthorizerError(t *testing.T) {
+	old := app.authorizer
+	SetAuthorizer(AuthorizerFunc(func(ctx *Context) ([]string, error) {
+		return nil, errors.New("authorizer down")
+	}))
+	t.Cleanup(func() { app.authorizer = old })
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) { ctx.SayStr("ok") }).Require("users:read"))
+	if status, code := authGet(t, srv.URL+"/test", grants("*")); status != http.StatusForbidden || code != SerPermissionDenied {
+		t.Errorf("status=%d code=%d", status, code)
+	}
+}
+
+func TestGroupRequire(t *testing.T) {
+	srv := setTestRouter(t)
+	ok := func(ctx *Context) { ctx.SayStr("ok") }
+	admin := Group("/admin", grantHeader).Require("admin")
+	admin.Get("/home", ok)
+	users := admin.Group("/users").Require("users:read")
+	users.Get("/list", ok)
+	users.Post("/delete", ok).Require("users:delete")
+	//a sibling group doesn't share the permissions of users
+	admin.Group("/orders").Require("orders:read").Get("/list", ok)
+
+	tests := []struct {
+		name, path string
+		grant      *string
+		status     int
+	}{
+		{"group unauthenticated", "/admin/home", nil, http.StatusUnauthorized},
+		{"group denied", "/admin/home", grants("users:read"), http.StatusForbidden},
+		{"group granted", "/admin/home", grants("admin"), http.StatusOK},
+		{"parent permission", "/admin/users/list", grants("users:read"), http.StatusForbidden},
+		{"sub permission", "/admin/users/list", grants("admin"), http.StatusForbidden},
+		{"inherited", "/admin/users/list", grants("admin,users:read"), http.StatusOK},
+		{"sibling", "/admin/orders/list", grants("admin,orders:read"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, _ := authGet(t, srv.URL+tt.path, tt.grant); status != tt.status {
+			t.Errorf("%s: status=%d,want %d", tt.name, status, tt.status)
+		}
+	}
+
+	want := map[string][]string{
+		"GET /admin/home":          {"admin"},
+		"GET /admin/users/list":    {"admin", "users:read"},
+		"POST /admin/users/delete": {"admin", "users:read", "users:delete"},
+		"GET /admin/orders/list":   {"admin", "orders:read"},
+	}
+	rs := Routes()
+	if len(rs) != len(want) {
+		t.Fatalf("routes=%v", rs)
+	}
+	for _, r := range rs {
+		if ps := want[r.Method+" "+r.Pattern]; !reflect.DeepEqual(r.Permissions, ps) {
+			t.Errorf("%s %s: permissions=%v,want %v", r.Method, r.Pattern, r.Permissions, ps)
+		}
+	}
+}
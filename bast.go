@@ -40,18 +40,24 @@ var (
 	-reload                       平滑升级程序(可以与conf同时使用)
 	-conf=your path/config.conf   配置文件路径  
 	-install                      安装开机启动服务
+	-rotate                       立即切割日志文件(可以与appkey同时使用)
+	-level=debug [-revert=600]    修改运行中程序的日志级别,revert秒后恢复(可以与appkey同时使用)
+	-set=[appkey:]path=value      覆盖配置项,可重复,如-set=log.level=debug(可以与start、conf同时使用)
+	-reload-conf                  重新加载配置文件,无效的配置不会生效(可以与appkey同时使用)
+	-print-conf                   显示合并环境变量和-set后的配置,敏感信息已屏蔽(可以与appkey、conf同时使用)
 	-uninstall                    卸载开机启动服务
 	`
 	flagDevelop, flagStart, flagStop, flagReload, flagDaemon        bool
 	isInstall, isUninstall, isForce, flagService, isMaster, isClear bool
-	flagConf, flagName, flagAppKey, flagPipe                        string
-	flagPPid                                                        int
+	flagRotate, flagPrintConf, flagReloadConf                       bool
+	flagSets                                                        setFlags
+	flagConf, flagName, flagAppKey, flagPipe, flagLevel             string
+	flagPPid, flagRevert                                            int
 	app                                                             *App
 )
 
 //App is application major data
 type App struct {
-	pool                                 sync.Pool
 	Router                               *httprouter.Router
 	Addr, pipeName                       string
 	Server                               *http.Server
@@ -59,6 +65,23 @@ type App struct {
 	After                                AfterHandle
 	Debug, Daemon, isCallCommand, runing bool
 	cmd                                  []work
+	routes                               []*Route
+	middlewares                          []Middleware
+	//DisableETag disable the automatic weak ETag
+	DisableETag bool
+	//maxBodyBytes,timeout and allowOrigins set by the code,
+	//the *Conf ones of the config override them if set,see applyLimits
+	maxBodyBytes, maxBodyBytesConf int64
+	timeout, timeoutConf           time.Duration
+	allowOrigins, allowOriginsConf []string
+	//confMu guards the limits above
+	confMu       sync.RWMutex
+	sessionConf  *SessionConf
+	sessionStore SessionStore
+	sessionMu    sync.Mutex
+	jwtConf      *JWTConf
+	jwtMu        sync.RWMutex
+	authorizer   Authorizer
 }
 
 type work struct {
@@ -74,9 +97,6 @@ func init() {
 	app = &App{Server: &http.Server{}, Router: httprouter.New(), runing: true}
 	parseCommandLine()
 	doHandle("OPTIONS", "/*filepath", nil)
-	app.pool.New = func() interface{} {
-		return &Context{}
-	}
 }
 
 //parseCommandLine parse commandLine
@@ -93,6 +113,12 @@ func parseCommandLine() {
 	f.BoolVar(&flagStart, "start", false, "")
 	f.BoolVar(&flagStop, "stop", false, "")
 	f.BoolVar(&flagReload, "reload", false, "")
+	f.BoolVar(&flagRotate, "rotate", false, "")
+	f.StringVar(&flagLevel, "level", "", "")
+	f.IntVar(&flagRevert, "revert", 0, "")
+	f.Var(&flagSets, "set", "")
+	f.BoolVar(&flagPrintConf, "print-conf", false, "")
+	f.BoolVar(&flagReloadConf, "reload-conf", false, "")
 	f.BoolVar(&flagDaemon, "daemon", false, "")
 	f.BoolVar(&isUninstall, "uninstall", false, "")
 	f.BoolVar(&isForce, "force", false, "")
@@ -122,7 +148,7 @@ func parseCommandLine() {
 	if isInstall {
 		flagDaemon = false
 	}
-	if flagDevelop || flagStop || flagReload || flagDaemon || isInstall || isUninstall || flagService {
+	if flagDevelop || flagStop || flagReload || flagDaemon || isInstall || isUninstall || flagService || flagRotate || flagLevel != "" || flagPrintConf || flagReloadConf {
 		flagStart = false
 	}
 	if flagService {
@@ -157,22 +183,49 @@ func (app *App) ListenAndServe() error {
 // Post registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func Post(pattern string, f func(ctx *Context)) {
-	doHandle("POST", pattern, f)
+func Post(pattern string, f func(ctx *Context)) *Route {
+	return doHandle("POST", pattern, f)
 }
 
 // Get registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func Get(pattern string, f func(ctx *Context)) {
-	doHandle("GET", pattern, f)
+func Get(pattern string, f func(ctx *Context)) *Route {
+	return doHandle("GET", pattern, f)
 }
 
 // FileServer registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func FileServer(pattern string, root string) {
-	app.Router.Handler("GET", pattern+"*filepath", NoLookDirHandler(http.StripPrefix(pattern, http.FileServer(http.Dir(root)))))
+func FileServer(pattern string, root string) *Route {
+	dir := http.Dir(root)
+	h := NoLookDirHandler(http.StripPrefix(pattern, serveFile(dir)))
+	r := doHandle("GET", pattern+"*filepath", func(ctx *Context) {
+		h.ServeHTTP(ctx.ResponseWriter, ctx.Request)
+	})
+	r.static = true
+	return r
+}
+
+//serveFile serve the file with a weak ETag from the opened file,
+//directories and errors are left to http.FileServer
+func serveFile(dir http.Dir) http.Handler {
+	fs := http.FileServer(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := dir.Open(r.URL.Path)
+		if err != nil {
+			fs.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			fs.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("ETag", fileETag(fi))
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	})
 }
 
 //NoLookDirHandler 不启用目录浏览
@@ -198,61 +251,14 @@ func NoLookDirHandler(h http.Handler) http.Handler {
 // doHandle registers the handler function for the given pattern
 // in the DefaultServeMux.
 // The documentation for ServeMux explains how patterns are matched.
-func doHandle(method, pattern string, f func(ctx *Context)) {
+func doHandle(method, pattern string, f func(ctx *Context)) *Route {
 	//app.Router.HandlerFunc(method,pattern)
-	app.Router.Handle(method, pattern, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		logs.Info(r.Method + ":" + r.RequestURI + "->start")
-		if origin := r.Header.Get("Origin"); origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Authorization,Access-Control-Allow-Origin,Content-Length,Content-Type,BaseUrl")
-			w.Header().Set("Access-Control-Max-Age", "1728000")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-		}
-		if r.Method == "OPTIONS" {
-			return
-		}
-		if pattern == "/" && r.URL.Path != pattern {
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprint(w, http.StatusText(http.StatusNotFound))
-			return
-		}
-		if r.Method == method {
-			if f != nil {
-				ctx := app.pool.Get().(*Context)
-				ctx.Reset()
-				defer app.pool.Put(ctx)
-				ctx.Request = r
-				ctx.In = r
-				ctx.ResponseWriter = w
-				ctx.Out = w
-				ctx.Params = ps
-				defer func() {
-					if err := recover(); err != nil {
-						errMsg := fmt.Sprintf("%s", err)
-						logs.Error(r.Method + ":" + r.RequestURI + "->error=" + errMsg)
-						w.WriteHeader(http.StatusInternalServerError)
-						fmt.Fprint(w, http.StatusText(http.StatusInternalServerError))
-					}
-				}()
-				if app.Before != nil {
-					if app.Before(ctx) != nil {
-						logs.Info(r.Method + ":" + r.RequestURI + "->end")
-						return
-					}
-				}
-				f(ctx)
-				if app.After != nil {
-					app.After(ctx)
-				}
-				logs.Info(r.Method + ":" + r.RequestURI + "->end")
-			}
-		} else {
-			logs.Info(r.Method + ":" + r.RequestURI + "->end=notAllowed")
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprint(w, http.StatusText(http.StatusMethodNotAllowed))
-		}
-	})
+	r := &Route{Method: method, Pattern: pattern, handler: f}
+	if f != nil {
+		app.routes = append(app.routes, r)
+	}
+	app.Router.Handle(method, pattern, r.serve)
+	return r
 }
 
 //Run app
@@ -269,23 +275,126 @@ func Debug(debug bool) {
 	app.Debug = debug
 }
 
+//MaxBodyBytes set the app max request body bytes,
+//a request exceeds it gets 413,the maxBodyBytes of the config overrides it
+func MaxBodyBytes(n int64) {
+	app.confMu.Lock()
+	app.maxBodyBytes = n
+	app.confMu.Unlock()
+}
+
+//Timeout set the app handler deadline,
+//a request exceeds it gets 503 and the request context is canceled,
+//the timeout of the config overrides it
+func Timeout(d time.Duration) {
+	app.confMu.Lock()
+	app.timeout = d
+	app.confMu.Unlock()
+}
+
+//AllowOrigins set the CORS and websocket allowed origins,
+//such as "https://example.com","*.example.com",empty allows any origin,
+//the allowOrigins of the config overrides it
+func AllowOrigins(origins ...string) {
+	app.confMu.Lock()
+	app.allowOrigins = origins
+	app.confMu.Unlock()
+}
+
+//applyLimits apply maxBodyBytes,timeout and allowOrigins of the config,
+//they override the values set by the code,an unset one falls back to the code value
+func applyLimits(c *AppConf) {
+	app.confMu.Lock()
+	app.maxBodyBytesConf = c.MaxBodyBytes
+	app.timeoutConf = confTimeout(c)
+	app.allowOriginsConf = c.AllowOrigins
+	app.confMu.Unlock()
+}
+
+//maxBody returns the app max request body bytes
+func (app *App) maxBody() int64 {
+	app.confMu.RLock()
+	defer app.confMu.RUnlock()
+	if app.maxBodyBytesConf != 0 {
+		return app.maxBodyBytesConf
+	}
+	return app.maxBodyBytes
+}
+
+//handlerTimeout returns the app handler deadline
+func (app *App) handlerTimeout() time.Duration {
+	app.confMu.RLock()
+	defer app.confMu.RUnlock()
+	if app.timeoutConf != 0 {
+		return app.timeoutConf
+	}
+	return app.timeout
+}
+
+//origins returns the app allowed origins
+func (app *App) origins() []string {
+	app.confMu.RLock()
+	defer app.confMu.RUnlock()
+	if len(app.allowOriginsConf) > 0 {
+		return app.allowOriginsConf
+	}
+	return app.allowOrigins
+}
+
+//applyConf apply the app config to the server
+func applyConf(c *AppConf) {
+	if c == nil {
+		return
+	}
+	applyLimits(c)
+	if c.Session != nil && app.sessionConf == nil {
+		app.sessionConf = c.Session
+	}
+	if len(c.TrustedProxies) > 0 {
+		if err := TrustedProxies(c.TrustedProxies...); err != nil {
+			logs.Err("trusted proxies error", err)
+		}
+	}
+	if c.JWT != nil {
+		if err := JWTInit(c.JWT); err != nil {
+			logs.Err("jwt init error", err)
+		}
+	}
+	if c.ReadTimeout > 0 {
+		app.Server.ReadTimeout = time.Duration(c.ReadTimeout) * time.Second
+	}
+	if c.WriteTimeout > 0 {
+		app.Server.WriteTimeout = time.Duration(c.WriteTimeout) * time.Second
+	}
+}
+
 //doRun real run app
 func doRun(addr string) {
 	app.Addr = addr
+	applyConf(Conf())
+	go watchConf()
 	err := tryRun()
 	if err == nil {
 		logs.Info("addr=" + app.Addr)
 		fmt.Println("start")
 		err = app.ListenAndServe()
+		if err == http.ErrServerClosed {
+			//wait for the accepted requests
+			shutdownWg.Wait()
+			err = nil
+		}
 		if err != nil {
 			fmt.Println("listenAndServe error=" + err.Error())
 			logs.Info("listenAndServe error=" + err.Error())
+			logs.Sync()
 			os.Exit(222)
 		}
 		fmt.Println("finish")
 		logs.Info("finish")
+		logs.Sync()
 	} else {
 		logs.Info("listen error=" + err.Error())
+		logs.Sync()
 		os.Exit(222)
 	}
 }
@@ -324,6 +433,18 @@ func Command() bool {
 		reload()
 		err = errors.New("inside child process for reload")
 		r = false
+	} else if flagRotate {
+		err = broadcastControl(&controlMsg{Cmd: "rotate", AppKey: flagAppKey})
+		r = false
+	} else if flagLevel != "" {
+		err = broadcastControl(&controlMsg{Cmd: "level", AppKey: flagAppKey, Args: map[string]string{"level": flagLevel, "revert": strconv.Itoa(flagRevert)}})
+		r = false
+	} else if flagPrintConf {
+		err = printConf()
+		r = false
+	} else if flagReloadConf {
+		err = broadcastControl(&controlMsg{Cmd: "reload-conf", AppKey: flagAppKey})
+		r = false
 	} else if flagDaemon {
 		daemon()
 	} else if isInstall {
@@ -348,7 +469,7 @@ func start() (bool, error) {
 		return false, nil
 	}
 	path := ConfPath()
-	cmd := exec.Command(os.Args[0], "-master", "-start", "-conf="+path)
+	cmd := exec.Command(os.Args[0], append([]string{"-master", "-start", "-conf=" + path}, setArgs()...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Dir = AppDir()
@@ -385,6 +506,7 @@ func doStart() error {
 	path := ConfPath()
 	pid := strconv.Itoa(os.Getpid())
 	app.pipeName = pid
+	masterControl()
 	if flagService {
 		logs.Info("service=" + path + ",master pid=" + pid)
 	} else {
@@ -392,7 +514,7 @@ func doStart() error {
 	}
 	app.cmd = []work{}
 	for _, c := range appConfs {
-		cmd := exec.Command(os.Args[0], "-daemon", "-appkey="+c.Key, "-pipe="+app.pipeName, "-pid="+pid, "-appkey="+flagAppKey, "-conf="+path)
+		cmd := exec.Command(os.Args[0], workArgs(c.Key, pid, path)...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Dir = AppDir()
@@ -408,13 +530,27 @@ func doStart() error {
 	return nil
 }
 
+//workArgs returns the args of the work process
+func workArgs(key, pid, path string) []string {
+	return append([]string{"-daemon", "-appkey=" + key, "-pipe=" + app.pipeName, "-pid=" + pid, "-conf=" + path}, setArgs()...)
+}
+
+//setArgs returns the -set flags passed to the child processes
+func setArgs() []string {
+	args := make([]string, len(flagSets))
+	for i, s := range flagSets {
+		args[i] = "-set=" + s
+	}
+	return args
+}
+
 func startWork(index int) *exec.Cmd {
 	w := app.cmd[index]
 	c := ConfWithKey(w.key)
 	if c != nil {
 		path := ConfPath()
 		pid := strconv.Itoa(os.Getpid())
-		cmd := exec.Command(os.Args[0], "-daemon", "-appkey="+c.Key, "-pipe="+app.pipeName, "-pid="+pid, "-appkey="+flagAppKey, "-conf="+path)
+		cmd := exec.Command(os.Args[0], workArgs(c.Key, pid, path)...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Dir = AppDir()
@@ -588,13 +724,14 @@ func sendSignal(sig os.Signal, pid int) error {
 func daemon() {
 	app.Daemon = true
 	go signalListen()
+	go controlListen()
 }
 
 func install() {
 	if flagName == "" {
 		flagName = AppName()
 	}
-	var agrs = []string{"-service", "-force", "-conf=" + flagConf}
+	var agrs = append([]string{"-service", "-force", "-conf=" + flagConf}, setArgs()...)
 
 	service, err := sdaemon.New(flagName, flagName+" service")
 	if err != nil {
@@ -627,7 +764,7 @@ func uninstall() {
 }
 
 func signalListen() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	defer close(c)
 	signal.Notify(c)
 	for {
@@ -744,8 +881,17 @@ func mgrList() []string {
 	}
 }
 
+//removePid remove the pid file written by this process,
+//the file of the new master is kept when the old processes exit after a reload
 func removePid() error {
 	pidPath := os.Args[0] + ".pid"
+	data, err := ioutil.ReadFile(pidPath)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(string(data), strconv.Itoa(os.Getpid())+"|") {
+		return nil
+	}
 	return os.Remove(pidPath)
 }
 
@@ -790,8 +936,13 @@ func pidPath(path ...string) string {
 	return pidPath
 }
 
-//Shutdown app
+//shutdownWg the running Shutdown calls,the server waits for them after it's closed
+var shutdownWg sync.WaitGroup
+
+//Shutdown app,the accepted requests are finished before Run returns
 func Shutdown(ctx context.Context) error {
+	shutdownWg.Add(1)
+	defer shutdownWg.Done()
 	if ctx == nil {
 		ctx = context.Background()
 		// var cf context.CancelFunc
@@ -823,6 +974,7 @@ func clear() {
 		return
 	}
 	isClear = true
+	controlClose()
 	logs.ClearLogger()
 	ids.IDClear()
 	removePid()
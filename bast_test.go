@@ -0,0 +1,169 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"github.com/julienschmidt/httprouter"
+)
+
+//testArgs the go test args,hidden from parseCommandLine in init,
+//the package variables are initialized before the init functions
+var testArgs = hideTestArgs()
+
+func hideTestArgs() []string {
+	args := os.Args
+	//-develop runs in the foreground like a debug run
+	os.Args = []string{args[0], "-develop"}
+	return args
+}
+
+//newTestRoute create a route that isn't registered in the app router
+func newTestRoute(f func(ctx *Context), ms ...Middleware) *Route {
+	return &Route{Method: "GET", Pattern: "/test", handler: f, middlewares: ms}
+}
+
+//serveRoute serve the route for any method and path,the server is closed with the test
+func serveRoute(t *testing.T, r *Route) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Method = req.Method
+		r.serve(w, req, nil)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+//setTestRouter replace the app router and routes with empty ones,
+//returns the server of the new router,they are restored after the test
+func setTestRouter(t *testing.T) *httptest.Server {
+	oldRouter, oldRoutes := app.Router, app.routes
+	app.Router, app.routes = httprouter.New(), nil
+	srv := httptest.NewServer(app.Router)
+	t.Cleanup(func() {
+		srv.Close()
+		app.Router, app.routes = oldRouter, oldRoutes
+	})
+	return srv
+}
+
+//setTestProxies set the trusted proxies,they are restored after the test
+func setTestProxies(t *testing.T, cidrs ...string) {
+	old := trustedNets.Load()
+	if err := TrustedProxies(cidrs...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedNets.Store(old) })
+}
+
+//setTestOrigins set the allowed origins by the code and clear the config ones,
+//they are restored after the test
+func setTestOrigins(t *testing.T, origins ...string) {
+	app.confMu.Lock()
+	old, oldConf := app.allowOrigins, app.allowOriginsConf
+	app.allowOrigins, app.allowOriginsConf = origins, nil
+	app.confMu.Unlock()
+	t.Cleanup(func() {
+		app.confMu.Lock()
+		app.allowOrigins, app.allowOriginsConf = old, oldConf
+		app.confMu.Unlock()
+	})
+}
+
+//setTestSession set the session config and store,they are restored after the test
+func setTestSession(t *testing.T, conf *SessionConf, store SessionStore) {
+	oldConf, oldStore := app.sessionConf, app.sessionStore
+	SessionInit(conf, store)
+	t.Cleanup(func() { SessionInit(oldConf, oldStore) })
+}
+
+//setTestJWT set the JWT config,it's restored after the test
+func setTestJWT(t *testing.T, conf *JWTConf) {
+	app.jwtMu.RLock()
+	old := app.jwtConf
+	app.jwtMu.RUnlock()
+	if err := JWTInit(conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		app.jwtMu.Lock()
+		app.jwtConf = old
+		app.jwtMu.Unlock()
+	})
+}
+
+//setTestConf set the current app config,the old config is restored after the test
+func setTestConf(t *testing.T, c *AppConf) {
+	mgr, _ := newConfMgr([]AppConf{*c}, false)
+	confMu.Lock()
+	old := confObj
+	confObj = mgr
+	confMu.Unlock()
+	t.Cleanup(func() {
+		confMu.Lock()
+		confObj = old
+		confMu.Unlock()
+	})
+}
+
+//setTestConfFile write the config file and load it,
+//the old config and path are restored after the test
+func setTestConfFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	confMu.Lock()
+	oldObj, oldPath := confObj, flagConf
+	confObj, flagConf = nil, path
+	confMu.Unlock()
+	t.Cleanup(func() {
+		confMu.Lock()
+		confObj, flagConf = oldObj, oldPath
+		confMu.Unlock()
+	})
+	if Conf() == nil {
+		t.Fatal("no config loaded from " + path)
+	}
+	return path
+}
+
+//setTestLog init the logger,it's cleared after the test
+func setTestLog(t *testing.T, conf *logs.LogConf) {
+	logs.Reinit(conf)
+	t.Cleanup(logs.ClearLogger)
+}
+
+func TestMain(m *testing.M) {
+	os.Args = testArgs
+	os.Exit(m.Run())
+}
+
+func TestApplyLimits(t *testing.T) {
+	defer func() {
+		MaxBodyBytes(0)
+		Timeout(0)
+		applyLimits(&AppConf{})
+	}()
+	MaxBodyBytes(100)
+	Timeout(time.Second)
+	applyLimits(&AppConf{})
+	if app.maxBody() != 100 || app.handlerTimeout() != time.Second {
+		t.Fatal("the code values are not used without config")
+	}
+	applyLimits(&AppConf{MaxBodyBytes: 200, Timeout: 2})
+	if app.maxBody() != 200 || app.handlerTimeout() != 2*time.Second {
+		t.Fatal("the config doesn't override the code values")
+	}
+	//a reload changes the limits again
+	applyLimits(&AppConf{MaxBodyBytes: 300})
+	if app.maxBody() != 300 || app.handlerTimeout() != time.Second {
+		t.Fatal("the reloaded config is not applied", app.maxBody(), app.handlerTimeout())
+	}
+}
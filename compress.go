@@ -0,0 +1,362 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+//CompressConf response compression config
+type CompressConf struct {
+	//MinSize the minimum body bytes to compress,default 1024
+	MinSize int `json:"minSize"`
+	//Level gzip level 1-9(-2 is Huffman only),0 or out of range means the default level
+	Level int `json:"level"`
+	//BrotliLevel brotli level 1-11,0 means the default level,the larger ones are clamped to 11
+	BrotliLevel int `json:"brotliLevel"`
+	//Types content-type allowlist(prefix match),
+	//default text/*,json,javascript,xml and svg,text/event-stream is never compressed
+	Types []string `json:"types"`
+	//DisableBrotli only use gzip
+	DisableBrotli bool `json:"disableBrotli"`
+}
+
+var defaultCompressTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/x-javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/ld+json",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+//Compress returns the response compression middleware,
+//it negotiates gzip or brotli by Accept-Encoding,
+//responses that already have Content-Encoding or aren't in the type allowlist are left as is
+//	bast.Use(bast.Compress(nil))
+func Compress(conf *CompressConf) Middleware {
+	c := &compressor{minSize: 1024, types: defaultCompressTypes, brotli: true, gzipLevel: gzip.DefaultCompression, brotliLevel: brotli.DefaultCompression}
+	if conf != nil {
+		if conf.MinSize > 0 {
+			c.minSize = conf.MinSize
+		}
+		if len(conf.Types) > 0 {
+			c.types = conf.Types
+		}
+		c.brotli = !conf.DisableBrotli
+		if conf.Level >= gzip.HuffmanOnly && conf.Level <= gzip.BestCompression && conf.Level != 0 {
+			c.gzipLevel = conf.Level
+		}
+		if conf.BrotliLevel > 0 {
+			c.brotliLevel = conf.BrotliLevel
+			if c.brotliLevel > brotli.BestCompression {
+				c.brotliLevel = brotli.BestCompression
+			}
+		}
+	}
+	c.gzipPool.New = func() interface{} {
+		w, err := gzip.NewWriterLevel(nil, c.gzipLevel)
+		if err != nil {
+			w = gzip.NewWriter(nil)
+		}
+		return w
+	}
+	c.brotliPool.New = func() interface{} {
+		return brotli.NewWriterLevel(nil, c.brotliLevel)
+	}
+	return c.handle
+}
+
+//compressor compression middleware
+type compressor struct {
+	minSize     int
+	gzipLevel   int
+	brotliLevel int
+	types       []string
+	brotli      bool
+	gzipPool    sync.Pool
+	brotliPool  sync.Pool
+}
+
+//handle see Middleware
+func (c *compressor) handle(ctx *Context, next func(ctx *Context)) {
+	r := ctx.Request
+	if r.Method == "HEAD" || r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" {
+		next(ctx)
+		return
+	}
+	encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+	rw := ctx.ResponseWriter
+	cw := &compressWriter{ResponseWriter: rw, c: c, encoding: encoding}
+	ctx.ResponseWriter = cw
+	ctx.Out = cw
+	defer func() {
+		if err := recover(); err != nil {
+			//don't flush the partial response as a 200,the recovery replies the error
+			cw.discard()
+			ctx.ResponseWriter = rw
+			ctx.Out = rw
+			panic(err)
+		}
+		cw.Close()
+		ctx.ResponseWriter = rw
+		ctx.Out = rw
+	}()
+	next(ctx)
+}
+
+//negotiate returns the preferred encoding of Accept-Encoding,
+//brotli is preferred when the q-values are equal
+func (c *compressor) negotiate(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, q := parseQuality(part)
+		if q <= 0 {
+			continue
+		}
+		switch name {
+		case encodingBrotli:
+			if !c.brotli {
+				continue
+			}
+		case encodingGzip, "*":
+			name = encodingGzip
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+//parseQuality parse "name;q=0.5"
+func parseQuality(s string) (string, float64) {
+	s = strings.TrimSpace(s)
+	q := 1.0
+	if i := strings.Index(s, ";"); i >= 0 {
+		param := strings.TrimSpace(s[i+1:])
+		s = strings.TrimSpace(s[:i])
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.ToLower(s), q
+}
+
+//typeAllowed check the content-type allowlist,
+//the server-sent events must reach the client as they are flushed
+func (c *compressor) typeAllowed(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	for _, t := range c.types {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+//compressWriter buffer the response until MinSize,then decide whether to compress,
+//encoding is empty if the client doesn't accept any,only Vary is set then
+type compressWriter struct {
+	http.ResponseWriter
+	c           *compressor
+	encoding    string
+	status      int
+	buf         []byte
+	decided     bool
+	wroteHeader bool
+	w           io.WriteCloser
+}
+
+//WriteHeader see http.ResponseWriter WriteHeader,the header is delayed until decided
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 || w.wroteHeader {
+		return
+	}
+	w.status = code
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+//Write see http.ResponseWriter Write
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.w != nil {
+			return w.w.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.c.minSize {
+		if err := w.decideAndFlush(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+//Flush see http.Flusher,buffered data is compressed if allowed
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decideAndFlush(len(w.buf) > 0)
+	}
+	if w.w != nil {
+		if f, ok := w.w.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack see http.Hijacker
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	w.decided = true
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+//Written returns true if the header has been written or set
+func (w *compressWriter) Written() bool {
+	return w.status != 0 || w.wroteHeader
+}
+
+//Unwrap returns the original http.ResponseWriter
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//Close flush the buffered data and close the compressor
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			//nothing written
+			return nil
+		}
+		if err := w.decideAndFlush(len(w.buf) >= w.c.minSize); err != nil {
+			return err
+		}
+	}
+	if w.w != nil {
+		err := w.w.Close()
+		w.release()
+		return err
+	}
+	return nil
+}
+
+//discard drop the buffered data and the compressor without writing them,
+//the header is left unwritten if it hasn't been decided
+func (w *compressWriter) discard() {
+	w.buf = nil
+	if w.w != nil {
+		w.release()
+	}
+	w.decided = true
+}
+
+//decideAndFlush decide and write the buffered data
+func (w *compressWriter) decideAndFlush(compress bool) error {
+	w.decide(compress)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.w != nil {
+		_, err = w.w.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+//decide write the header and create the compressor if allowed
+func (w *compressWriter) decide(compress bool) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" && len(w.buf) > 0 {
+		contentType = http.DetectContentType(w.buf)
+		h.Set("Content-Type", contentType)
+	}
+	allowed := w.c.typeAllowed(contentType) && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == ""
+	if allowed {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if compress && allowed && w.encoding != "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == encodingBrotli {
+			bw := w.c.brotliPool.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.w = bw
+		} else {
+			gw := w.c.gzipPool.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.w = gw
+		}
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+//release put the compressor back to the pool
+func (w *compressWriter) release() {
+	switch cw := w.w.(type) {
+	case *brotli.Writer:
+		w.c.brotliPool.Put(cw)
+	case *gzip.Writer:
+		w.c.gzipPool.Put(cw)
+	}
+	w.w = nil
+}
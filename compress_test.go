@@ -0,0 +1,96 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressPanic(t *testing.T) {
+	m := Compress(&CompressConf{Level: 99, BrotliLevel: 99})
+	panicURL := serveRoute(t, newTestRoute(func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		ctx.ResponseWriter.Write([]byte("partial"))
+		panic("compress test panic")
+	}, m)).URL
+	okURL := serveRoute(t, newTestRoute(func(ctx *Context) {
+		ctx.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		ctx.ResponseWriter.Write([]byte(strings.Repeat("a", 2048)))
+	}, m)).URL
+
+	tests := []struct {
+		url, accept, encoding string
+		status                int
+	}{
+		{panicURL, "gzip", "", http.StatusInternalServerError},
+		{panicURL, "br", "", http.StatusInternalServerError},
+		{okURL, "gzip", "gzip", http.StatusOK},
+		{okURL, "br", "br", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url+"/test", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status || res.Header.Get("Content-Encoding") != tt.encoding {
+			t.Errorf("%s %s: status=%d encoding=%q,want %d %q", tt.url, tt.accept, res.StatusCode, res.Header.Get("Content-Encoding"), tt.status, tt.encoding)
+		}
+		if strings.Contains(string(body), "partial") {
+			t.Errorf("%s %s: the partial body is sent", tt.url, tt.accept)
+		}
+	}
+}
+
+func TestCompressEventStream(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	r := newTestRoute(func(ctx *Context) {
+		w, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Data("first")
+		<-done
+	}, Compress(&CompressConf{Types: []string{"text/"}}))
+	r.Timeout(-1)
+	srv := serveRoute(t, r)
+	req, _ := http.NewRequest("GET", srv.URL+"/test", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if e := res.Header.Get("Content-Encoding"); e != "" {
+		t.Fatal("the event stream is compressed,encoding=" + e)
+	}
+	//the event arrives before the handler returns
+	line := make(chan string, 1)
+	go func() {
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			if strings.HasPrefix(s.Text(), "data: ") {
+				line <- s.Text()
+				return
+			}
+		}
+	}()
+	select {
+	case l := <-line:
+		if l != "data: first" {
+			t.Fatal(l)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the event is not flushed")
+	}
+}
@@ -1,17 +1,19 @@
 package bast
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/aixiaoxiang/bast/logs"
 )
 
 var (
 	confObj    *AppConfMgr
+	confMu     sync.RWMutex
 	confHandle ConfHandle
 )
 
@@ -36,6 +38,31 @@ type AppConf struct {
 	Log     *logs.LogConf `json:"log"`
 	Conf    interface{}   `json:"conf"`
 	Extend  string        `json:"extend"`
+	//MaxBodyBytes max request body bytes,0 means unlimited
+	MaxBodyBytes int64 `json:"maxBodyBytes"`
+	//ReadTimeout server read timeout(seconds)
+	ReadTimeout int `json:"readTimeout"`
+	//WriteTimeout server write timeout(seconds)
+	WriteTimeout int `json:"writeTimeout"`
+	//Timeout handler deadline(seconds)
+	Timeout int `json:"timeout"`
+	//AllowOrigins CORS and websocket allowed origins,empty allows any origin
+	AllowOrigins []string `json:"allowOrigins"`
+	//Session session config
+	Session *SessionConf `json:"session"`
+	//JWT JWT authentication config
+	JWT *JWTConf `json:"jwt"`
+	//CSRF CSRF config
+	CSRF *CSRFConf `json:"csrf"`
+	//RateLimits named rate limit policies,see RateLimitPolicy
+	RateLimits map[string]*RateLimitConf `json:"rateLimits"`
+	//TrustedProxies trusted proxy CIDRs,default loopback only
+	TrustedProxies []string `json:"trustedProxies"`
+	//IPFilters named ip allow/deny lists,see IPFilterPolicy
+	IPFilters map[string]*IPFilterConf `json:"ipFilters"`
+	//ConfWatch interval(seconds) checking the config file,it's reloaded if changed,default 5,negative disables it,
+	//see ReloadConf
+	ConfWatch int `json:"confWatch"`
 }
 
 //ConfItem default db config
@@ -50,66 +77,84 @@ type ConfItem struct {
 	Loc       string `json:"dbLoc"`
 }
 
-//ConfMgr  config
+//ConfMgr  config,the format is detected by the file extension,see parseConf
 func ConfMgr() *AppConfMgr {
-	if confObj == nil {
+	confMu.RLock()
+	mgr := confObj
+	confMu.RUnlock()
+	if mgr == nil {
 		data, err := ioutil.ReadFile(ConfPath())
 		if err != nil {
 			return nil
 		}
-		appConf := []AppConf{}
-		err = json.Unmarshal(data, &appConf)
+		appConf, err := parseConf(ConfPath(), data)
 		if err != nil {
 			logs.Err("conf mgr init error", err)
 			return nil
 		}
 		ConfInit(appConf)
+		confMu.RLock()
+		mgr = confObj
+		confMu.RUnlock()
 	}
-	return confObj
+	return mgr
 }
 
-//ConfInit  config
+//ConfInit  config,the environment variables and -set flags are applied,see applyOverrides
 func ConfInit(appConf []AppConf) {
-	lg := len(appConf)
-	if lg == 0 {
+	if len(appConf) == 0 {
 		return
 	}
-	if confObj == nil {
-		confObj = &AppConfMgr{}
-		confObj.rawConfs = appConf
-		confObj.Confs = make(map[string]*AppConf)
-		for i := 0; i < lg; i++ {
-			c := &appConf[i]
-			if confHandle != nil {
-				err := confHandle(c)
-				if err != nil {
-					continue
+	confMu.RLock()
+	mgr := confObj
+	confMu.RUnlock()
+	if mgr == nil {
+		applyOverrides(appConf)
+		mgr, _ = newConfMgr(appConf, false)
+		confMu.Lock()
+		if confObj == nil {
+			confObj = mgr
+		}
+		confMu.Unlock()
+	}
+}
+
+//newConfMgr create the config manager,
+//the items rejected by the conf handle are skipped,or returns the error if strict
+func newConfMgr(appConf []AppConf, strict bool) (*AppConfMgr, error) {
+	lg := len(appConf)
+	mgr := &AppConfMgr{}
+	mgr.rawConfs = appConf
+	mgr.Confs = make(map[string]*AppConf)
+	for i := 0; i < lg; i++ {
+		c := &appConf[i]
+		if confHandle != nil {
+			err := confHandle(c)
+			if err != nil {
+				if strict {
+					return nil, errors.New("app " + c.Key + ":" + err.Error())
 				}
+				continue
 			}
-			if c.Key == flagAppKey && confObj.frist == nil {
-				confObj.frist = c
-			}
-			confObj.Confs[c.Key] = c
 		}
-		if confObj.frist == nil {
-			confObj.frist = &appConf[0]
+		if c.Key == flagAppKey && mgr.frist == nil {
+			mgr.frist = c
 		}
+		mgr.Confs[c.Key] = c
 	}
+	if mgr.frist == nil {
+		mgr.frist = &appConf[0]
+	}
+	return mgr, nil
 }
 
-//ConfOK check conf
-func ConfOK() bool {
-	return ConfMgr() != nil
-}
-
-//Conf returns the current app config
-func Conf() *AppConf {
-	appConf := ConfMgr()
-	if appConf != nil && appConf.Confs != nil {
+//current returns the config of the -appkey app,the first app if no -appkey
+func (mgr *AppConfMgr) current() *AppConf {
+	if mgr != nil && mgr.Confs != nil {
 		if flagAppKey == "" {
-			return appConf.frist
+			return mgr.frist
 		}
-		c, ok := appConf.Confs[flagAppKey]
+		c, ok := mgr.Confs[flagAppKey]
 		if c != nil && ok {
 			return c
 		}
@@ -117,6 +162,16 @@ func Conf() *AppConf {
 	return nil
 }
 
+//ConfOK check conf
+func ConfOK() bool {
+	return ConfMgr() != nil
+}
+
+//Conf returns the current app config
+func Conf() *AppConf {
+	return ConfMgr().current()
+}
+
 //ConfWithKey returns the key app config
 func ConfWithKey(key string) *AppConf {
 	appConf := ConfMgr()
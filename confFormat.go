@@ -0,0 +1,143 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//parseConf parse the app configs by the file extension,
+//.yaml/.yml is YAML,.toml is TOML,others are JSON with comments,
+//YAML and TOML use the json names of AppConf,
+//a YAML list or a TOML [[app]] array holds the apps,a single table is one app,
+//YAML 1.1 reads the bare keys y,n,yes,no,on,off as booleans,quote them
+func parseConf(path string, data []byte) ([]AppConf, error) {
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		m := map[string]interface{}{}
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, err
+		}
+		v = m
+		for _, key := range []string{"app", "apps"} {
+			if apps, ok := m[key]; ok {
+				v = apps
+				break
+			}
+		}
+	default:
+		data = stripJSONComments(data)
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	}
+	v = normalizeConf(v)
+	if m, ok := v.(map[string]interface{}); ok {
+		v = []interface{}{m}
+	}
+	if _, ok := v.([]interface{}); !ok {
+		return nil, errors.New("the config must be a list of apps")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	appConf := []AppConf{}
+	if err = json.Unmarshal(data, &appConf); err != nil {
+		return nil, err
+	}
+	return appConf, nil
+}
+
+//normalizeConf convert the YAML maps to map[string]interface{} and the TOML tables to []interface{}
+func normalizeConf(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = normalizeConf(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = normalizeConf(e)
+		}
+		return t
+	case []map[string]interface{}:
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			s[i] = normalizeConf(e)
+		}
+		return s
+	case []interface{}:
+		for i, e := range t {
+			t[i] = normalizeConf(e)
+		}
+		return t
+	}
+	return v
+}
+
+//stripJSONComments replace the // and /* */ comments with spaces and remove the trailing commas,
+//the line breaks are kept so the error offsets still match the file
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	inString := false
+	//comma the offset of a pending comma,-1 if none
+	comma := -1
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+			comma = -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		case c == ',':
+			comma = i
+		case c == ']' || c == '}':
+			if comma >= 0 {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			comma = -1
+		}
+	}
+	return out
+}
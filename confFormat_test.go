@@ -0,0 +1,131 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testJSONConf = `[
+	//the api app
+	{
+		"key": "api",
+		"addr": ":9999",
+		"baseUrl": "http://example.com/a//b", /* the comment markers in strings are kept */
+		"debug": true,
+		"maxBodyBytes": 1048576,
+		"log": {"outPath": "./logs/api.log", "level": "info",},
+		"allowOrigins": ["https://a.com", "https://b.com",],
+		"rateLimits": {"api": {"algorithm": "slidingWindow", "limit": 10, "period": 60}},
+		"ipFilters": {"admin": {"allow": ["10.0.0.0/8"], "deny": []}},
+		"conf": {"name": "db", "port": 3306, "tags": ["a", "b"]},
+	},
+	{"key": "admin", "addr": ":9998"},
+]`
+
+const testYAMLConf = `
+# the api app
+- key: api
+  addr: ":9999"
+  baseUrl: http://example.com/a//b
+  debug: true
+  maxBodyBytes: 1048576
+  log:
+    outPath: ./logs/api.log
+    level: info
+  allowOrigins: [https://a.com, https://b.com]
+  rateLimits:
+    api: {algorithm: slidingWindow, limit: 10, period: 60}
+  ipFilters:
+    admin:
+      allow: [10.0.0.0/8]
+      deny: []
+  conf:
+    name: db
+    port: 3306
+    tags: [a, b]
+- key: admin
+  addr: ":9998"
+`
+
+const testTOMLConf = `
+# the api app
+[[app]]
+key = "api"
+addr = ":9999"
+baseUrl = "http://example.com/a//b"
+debug = true
+maxBodyBytes = 1048576
+allowOrigins = ["https://a.com", "https://b.com"]
+
+[app.log]
+outPath = "./logs/api.log"
+level = "info"
+
+[app.rateLimits.api]
+algorithm = "slidingWindow"
+limit = 10
+period = 60
+
+[app.ipFilters.admin]
+allow = ["10.0.0.0/8"]
+deny = []
+
+[app.conf]
+name = "db"
+port = 3306
+tags = ["a", "b"]
+
+[[app]]
+key = "admin"
+addr = ":9998"
+`
+
+func TestParseConfFormats(t *testing.T) {
+	want, err := parseConf("conf.json", []byte(testJSONConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 2 || want[0].BaseURL != "http://example.com/a//b" || want[0].RateLimits["api"].Limit != 10 {
+		t.Fatalf("json=%+v", want)
+	}
+	for _, path := range []string{"conf.yaml", "conf.yml", "conf.toml"} {
+		data := testYAMLConf
+		if path == "conf.toml" {
+			data = testTOMLConf
+		}
+		got, err := parseConf(path, []byte(data))
+		if err != nil {
+			t.Fatal(path, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n%+v\nwant\n%+v", path, got, want)
+		}
+	}
+}
+
+func TestParseConfSingleApp(t *testing.T) {
+	tests := []struct {
+		path, data string
+	}{
+		{"conf.json", `{"key": "api", "addr": ":9999"} // one app`},
+		{"conf.yaml", "key: api\naddr: \":9999\"\n"},
+		{"conf.toml", "key = \"api\"\naddr = \":9999\"\n"},
+	}
+	for _, tt := range tests {
+		got, err := parseConf(tt.path, []byte(tt.data))
+		if err != nil || len(got) != 1 || got[0].Key != "api" || got[0].Addr != ":9999" {
+			t.Errorf("%s: %+v,%v", tt.path, got, err)
+		}
+	}
+	for _, tt := range []struct{ path, data string }{
+		{"conf.json", `"api"`},
+		{"conf.yaml", "- key: [api\n"},
+		{"conf.toml", "key = \n"},
+	} {
+		if _, err := parseConf(tt.path, []byte(tt.data)); err == nil {
+			t.Errorf("%s: %q is parsed", tt.path, tt.data)
+		}
+	}
+}
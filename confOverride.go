@@ -0,0 +1,323 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//setFlags the repeated -set flags
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+//applyOverrides patch the app configs with the environment variables and then the -set flags,
+//BAST_<APPKEY>_<PATH>=value,such as BAST_MYAPP_LOG_LEVEL=debug,
+//the key is upper case with the other chars as _,the path matches the json names ignoring _ and case,
+//-set [appkey:]path=value,such as -set log.level=debug,-set myapp:conf.redis.addr=127.0.0.1:6379,
+//a path without appkey patches every app,
+//the value is converted to the field type,lists are comma-separated or JSON,structs are JSON
+func applyOverrides(appConf []AppConf) {
+	for _, err := range envOverrides(appConf, os.Environ()) {
+		logs.Err("conf override error", err)
+		fmt.Fprintln(os.Stderr, "conf override error,"+err.Error())
+	}
+	for _, err := range setOverrides(appConf, flagSets) {
+		logs.Err("conf override error", err)
+		fmt.Fprintln(os.Stderr, "conf override error,"+err.Error())
+	}
+}
+
+//envOverrides apply the BAST_<APPKEY>_<PATH> variables,the longest matching appkey wins
+func envOverrides(appConf []AppConf, environ []string) []error {
+	sort.Strings(environ)
+	var errs []error
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv, "BAST_") {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		var c *AppConf
+		prefix := ""
+		for j := range appConf {
+			p := "BAST_" + envName(appConf[j].Key) + "_"
+			if appConf[j].Key != "" && strings.HasPrefix(name, p) && len(p) > len(prefix) {
+				c, prefix = &appConf[j], p
+			}
+		}
+		if c == nil {
+			continue
+		}
+		var tokens []string
+		for _, t := range strings.Split(name[len(prefix):], "_") {
+			if t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+		if err := setConfPath(reflect.ValueOf(c).Elem(), tokens, value, true); err != nil {
+			errs = append(errs, errors.New(name+":"+err.Error()))
+		}
+	}
+	return errs
+}
+
+//setOverrides apply the -set flags to the matched apps,returns an error per flag and failing app
+func setOverrides(appConf []AppConf, sets []string) []error {
+	var errs []error
+	for _, s := range sets {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			errs = append(errs, errors.New(s+":missing =value"))
+			continue
+		}
+		path, value, key := s[:i], s[i+1:], ""
+		if j := strings.IndexByte(path, ':'); j >= 0 {
+			key, path = path[:j], path[j+1:]
+		}
+		tokens := strings.Split(path, ".")
+		for j := range appConf {
+			if key != "" && appConf[j].Key != key {
+				continue
+			}
+			if err := setConfPath(reflect.ValueOf(&appConf[j]).Elem(), tokens, value, false); err != nil {
+				//the other apps are still set,the error is reported per app
+				errs = append(errs, errors.New(s+":app "+appConf[j].Key+":"+err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+//envName returns the upper case name with the other chars as _
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+//matchName returns the number of tokens matching the name,0 if not matched,
+//env tokens match the name ignoring _ and case,the longest match wins
+func matchName(name string, tokens []string, env bool) int {
+	if !env {
+		if strings.EqualFold(name, tokens[0]) {
+			return 1
+		}
+		return 0
+	}
+	name = strings.ToLower(strings.Replace(name, "_", "", -1))
+	for k := len(tokens); k > 0; k-- {
+		if name == strings.ToLower(strings.Join(tokens[:k], "")) {
+			return k
+		}
+	}
+	return 0
+}
+
+//jsonName returns the json name of the field,empty if not encoded
+func jsonName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "-" {
+		return ""
+	}
+	if tag == "" {
+		return f.Name
+	}
+	return tag
+}
+
+//setConfPath set the value of the path,nil pointers and maps are created
+func setConfPath(v reflect.Value, tokens []string, value string, env bool) error {
+	if len(tokens) == 0 {
+		return setConfValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setConfPath(v.Elem(), tokens, value, env)
+	case reflect.Struct:
+		index, n := -1, 0
+		for i := 0; i < v.NumField(); i++ {
+			if name := jsonName(v.Type().Field(i)); name != "" {
+				if k := matchName(name, tokens, env); k > n {
+					index, n = i, k
+				}
+			}
+		}
+		if index < 0 {
+			return errors.New("unknown field " + strings.Join(tokens, "."))
+		}
+		return setConfPath(v.Field(index), tokens[n:], value, env)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.New("unsupported map " + v.Type().String())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		var key reflect.Value
+		n := 0
+		for _, k := range v.MapKeys() {
+			if m := matchName(k.String(), tokens, env); m > n {
+				key, n = k, m
+			}
+		}
+		if n == 0 {
+			//a new key,env takes all the tokens
+			n = 1
+			if env {
+				n = len(tokens)
+			}
+			key = reflect.ValueOf(strings.Join(tokens[:n], "_")).Convert(v.Type().Key())
+			if env {
+				key = reflect.ValueOf(strings.ToLower(key.String())).Convert(v.Type().Key())
+			}
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if e := v.MapIndex(key); e.IsValid() {
+			elem.Set(e)
+		}
+		if err := setConfPath(elem, tokens[n:], value, env); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case reflect.Interface:
+		m, ok := v.Interface().(map[string]interface{})
+		if !ok || m == nil {
+			m = map[string]interface{}{}
+			v.Set(reflect.ValueOf(m))
+		}
+		return setConfPath(reflect.ValueOf(m), tokens, value, env)
+	}
+	return errors.New("unknown field " + strings.Join(tokens, "."))
+}
+
+//setConfValue convert the text to the type of v
+func setConfValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Interface:
+		//keep the type of the current value,otherwise JSON or the text
+		var nv interface{} = value
+		switch v.Interface().(type) {
+		case string:
+		case bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			nv = b
+		case float64:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return err
+			}
+			nv = n
+		default:
+			var j interface{}
+			if json.Unmarshal([]byte(value), &j) == nil {
+				nv = j
+			}
+		}
+		v.Set(reflect.ValueOf(&nv).Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var vs []string
+			for _, s := range strings.Split(value, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					vs = append(vs, s)
+				}
+			}
+			v.Set(reflect.ValueOf(vs).Convert(v.Type()))
+			return nil
+		}
+		fallthrough
+	default:
+		p := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), p.Interface()); err != nil {
+			return err
+		}
+		v.Set(p.Elem())
+	}
+	return nil
+}
+
+//printConf print the effective configs of the -appkey app or all apps,the secrets are masked
+func printConf() error {
+	var v interface{}
+	if flagAppKey != "" {
+		c := ConfWithKey(flagAppKey)
+		if c == nil {
+			return errors.New("app " + flagAppKey + " not found in " + ConfPath())
+		}
+		v = c
+	} else {
+		confs := Confs()
+		if confs == nil {
+			return errors.New("no config in " + ConfPath())
+		}
+		v = confs
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(logs.RedactText(string(data)))
+	return nil
+}
@@ -0,0 +1,140 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	appConf := []AppConf{
+		{Key: "my-app", RateLimits: map[string]*RateLimitConf{"api": {Limit: 1}}},
+		{Key: "my", Conf: map[string]interface{}{"port": 3306.0}},
+	}
+	errs := envOverrides(appConf, []string{
+		"BAST_MY_APP_ADDR=:9999",
+		"BAST_MY_APP_LOG_LEVEL=debug",
+		"BAST_MY_APP_MAXBODYBYTES=100",
+		"BAST_MY_APP_ALLOW_ORIGINS=https://a.com, https://b.com",
+		"BAST_MY_APP_RATE_LIMITS_API_LIMIT=5",
+		"BAST_MY_CONF_PORT=3307",
+		"BAST_MY_CONF_REDIS_ADDR=127.0.0.1:6379",
+		"BAST_MY_APP_NOPE=1",
+		"BAST_OTHER_ADDR=:1",
+		"PATH=/bin",
+	})
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "BAST_MY_APP_NOPE:") {
+		t.Errorf("errs=%v", errs)
+	}
+	a, my := appConf[0], appConf[1]
+	if a.Addr != ":9999" || my.Addr != "" {
+		t.Errorf("the longest appkey doesn't win,addr=%q %q", a.Addr, my.Addr)
+	}
+	if a.Log == nil || a.Log.Level != "debug" || a.MaxBodyBytes != 100 || a.RateLimits["api"].Limit != 5 {
+		t.Errorf("my-app=%+v", a)
+	}
+	if !reflect.DeepEqual(a.AllowOrigins, []string{"https://a.com", "https://b.com"}) {
+		t.Errorf("allowOrigins=%v", a.AllowOrigins)
+	}
+	//a new key of the map takes all the remaining tokens
+	want := map[string]interface{}{"port": 3307.0, "redis_addr": "127.0.0.1:6379"}
+	if !reflect.DeepEqual(my.Conf, want) {
+		t.Errorf("conf=%#v", my.Conf)
+	}
+}
+
+func TestSetOverrides(t *testing.T) {
+	appConf := []AppConf{
+		{Key: "a", Conf: map[string]interface{}{"port": 3306.0, "name": "db"}},
+		{Key: "b"},
+	}
+	errs := setOverrides(appConf, []string{
+		"log.level=warn",
+		"a:addr=:9999",
+		"debug=yes",
+		"conf.port=3307",
+		"b:allowOrigins=[\"https://a.com\"]",
+		"a:ipFilters.admin={\"allow\":[\"10.0.0.0/8\"]}",
+		"missing",
+	})
+	//debug fails for both apps,the flag without value once
+	if len(errs) != 3 {
+		t.Errorf("errs=%v", errs)
+	}
+	a, b := appConf[0], appConf[1]
+	if a.Log == nil || a.Log.Level != "warn" || b.Log == nil || b.Log.Level != "warn" {
+		t.Error("log.level isn't set for every app")
+	}
+	if a.Addr != ":9999" || b.Addr != "" {
+		t.Errorf("addr=%q %q", a.Addr, b.Addr)
+	}
+	if !reflect.DeepEqual(a.Conf, map[string]interface{}{"port": 3307.0, "name": "db"}) {
+		t.Errorf("a conf=%#v", a.Conf)
+	}
+	if !reflect.DeepEqual(b.Conf, map[string]interface{}{"port": 3307.0}) {
+		t.Errorf("b conf=%#v", b.Conf)
+	}
+	if !reflect.DeepEqual(b.AllowOrigins, []string{"https://a.com"}) || a.AllowOrigins != nil {
+		t.Errorf("allowOrigins=%v %v", a.AllowOrigins, b.AllowOrigins)
+	}
+	if f := a.IPFilters["admin"]; f == nil || !reflect.DeepEqual(f.Allow, []string{"10.0.0.0/8"}) {
+		t.Errorf("ipFilters=%v", a.IPFilters)
+	}
+}
+
+//capturePrintConf returns the output of printConf
+func capturePrintConf(t *testing.T) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = printConf()
+	os.Stdout = stdout
+	w.Close()
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPrintConf(t *testing.T) {
+	setTestLog(t, &logs.LogConf{Outputs: []*logs.OutputConf{{Type: "stdout"}}})
+	sets, appKey := flagSets, flagAppKey
+	t.Cleanup(func() { flagSets, flagAppKey = sets, appKey })
+	flagSets = setFlags{"a:conf.dbPwd=set-pwd", "b:csrf.secret=set-secret", "a:conf.dbUser=root"}
+	flagAppKey = ""
+	setTestConfFile(t, "conf.json", `[
+		{"key": "a", "conf": {"dbPwd": "file-pwd"}},
+		{"key": "b", "session": {"secret": "file-secret"}}
+	]`)
+
+	all := capturePrintConf(t)
+	for _, s := range []string{"set-pwd", "file-pwd", "set-secret", "file-secret"} {
+		if strings.Contains(all, s) {
+			t.Errorf("%s is printed:\n%s", s, all)
+		}
+	}
+	if !strings.Contains(all, `"dbUser": "root"`) || !strings.Contains(all, `"key": "b"`) {
+		t.Errorf("the overrides are missing:\n%s", all)
+	}
+
+	flagAppKey = "a"
+	one := capturePrintConf(t)
+	if !strings.Contains(one, `"dbUser": "root"`) || strings.Contains(one, `"key": "b"`) || strings.Contains(one, "set-pwd") {
+		t.Errorf("app a:\n%s", one)
+	}
+	flagAppKey = "none"
+	if err := printConf(); err == nil {
+		t.Error("the missing app is printed")
+	}
+}
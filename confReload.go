@@ -0,0 +1,304 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//ConfChangeHandle the handler of the config change,old and new are the configs of the current app
+type ConfChangeHandle func(old, new *AppConf)
+
+var (
+	confChangeHandles []ConfChangeHandle
+	confChangeMu      sync.Mutex
+	reloadMu          sync.Mutex
+	//confStat the modification time and size of the last loaded config file
+	confStat    os.FileInfo
+	confWatched bool
+)
+
+func init() {
+	onControl("reload-conf", func(map[string]string) (string, error) {
+		if err := ReloadConf(); err != nil {
+			return "", err
+		}
+		return "reloaded", nil
+	})
+}
+
+//OnConfChange registers the handler called after the config is reloaded and applied,
+//the handlers are called in the registration order
+//	bast.OnConfChange(func(old, new *bast.AppConf) {
+//		if !reflect.DeepEqual(old.Conf, new.Conf) {
+//			reconnectDB(new.Conf)
+//		}
+//	})
+func OnConfChange(f ConfChangeHandle) {
+	confChangeMu.Lock()
+	confChangeHandles = append(confChangeHandles, f)
+	confChangeMu.Unlock()
+}
+
+//ReloadConf read the config file again,apply the environment variables and -set flags and validate it,
+//then swap the config and apply the changes of log,CORS,limits,timeouts,JWT and trusted proxies,
+//the workers are restarted gracefully by the master(see -reload) if addr,readTimeout or writeTimeout changes,
+//the old config is kept if the new one is invalid,
+//the session applies on the next start
+func ReloadConf() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	old := Conf()
+	if old == nil {
+		return errors.New("no config loaded from " + ConfPath())
+	}
+	path := ConfPath()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	confStat = fi
+	appConf, err := parseConf(path, data)
+	if err != nil {
+		return err
+	}
+	if len(appConf) == 0 {
+		return errors.New("no app in " + path)
+	}
+	applyOverrides(appConf)
+	for i := range appConf {
+		if err := validateConf(&appConf[i]); err != nil {
+			return errors.New("app " + appConf[i].Key + ":" + err.Error())
+		}
+	}
+	mgr, err := newConfMgr(appConf, true)
+	if err != nil {
+		return err
+	}
+	c := mgr.current()
+	if c == nil {
+		return errors.New("app " + flagAppKey + " not found in " + path)
+	}
+	restart := serverConfChanged(old, c)
+	if restart && c.Addr != old.Addr && c.Addr != "" {
+		//the new workers would exit if the address is unavailable,reject the config
+		l, err := net.Listen("tcp", c.Addr)
+		if err != nil {
+			return err
+		}
+		l.Close()
+	}
+	confMu.Lock()
+	confObj = mgr
+	confMu.Unlock()
+	reloadConf(old, c)
+	confChangeMu.Lock()
+	handles := make([]ConfChangeHandle, len(confChangeHandles))
+	copy(handles, confChangeHandles)
+	confChangeMu.Unlock()
+	for _, f := range handles {
+		f(old, c)
+	}
+	logs.Info("conf reloaded,path=" + path)
+	if restart {
+		restartWorkers()
+	}
+	return nil
+}
+
+//serverConfChanged returns true if the settings of the http server change,
+//they can't be applied to the running server,the addr set by the code is kept
+func serverConfChanged(old, c *AppConf) bool {
+	return c.Addr != old.Addr && app.Addr == old.Addr ||
+		c.ReadTimeout != old.ReadTimeout ||
+		c.WriteTimeout != old.WriteTimeout
+}
+
+//restartWorkers ask the master to restart the workers gracefully,
+//the old workers finish the accepted requests,
+//the settings apply on the next start if the process isn't a work process of the master
+func restartWorkers() {
+	if !app.Daemon || flagPPid == 0 {
+		logs.Info("addr,readTimeout and writeTimeout apply on the next start")
+		return
+	}
+	reply, err := sendControl(flagPPid, &controlMsg{Cmd: "restart"})
+	if err == nil && !reply.OK {
+		err = errors.New(reply.Msg)
+	}
+	if err != nil {
+		logs.Err("restart work process error", err)
+		return
+	}
+	logs.Info("restart work process to apply the server settings," + reply.Msg)
+}
+
+var (
+	restartMu sync.Mutex
+	restartAt time.Time
+)
+
+//restartMaster the master runs -reload to restart the workers,
+//the workers of the other apps may also request it for the same file change,it runs once
+func restartMaster(map[string]string) (string, error) {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	if time.Since(restartAt) < 10*time.Second {
+		return "restarting", nil
+	}
+	cmd := exec.Command(os.Args[0], append([]string{"-reload", "-conf=" + ConfPath()}, setArgs()...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = AppDir()
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	restartAt = time.Now()
+	go cmd.Wait()
+	return "restarting", nil
+}
+
+//validateConf check the items applied on reload
+func validateConf(c *AppConf) error {
+	if c.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+			return err
+		}
+	}
+	if c.Log != nil && c.Log.Level != "" {
+		if _, err := logs.ParseLevel(c.Log.Level); err != nil {
+			return err
+		}
+	}
+	if _, err := parseCIDRs(c.TrustedProxies); err != nil {
+		return err
+	}
+	for name, f := range c.IPFilters {
+		if f == nil {
+			continue
+		}
+		if _, err := parseCIDRs(f.Allow); err != nil {
+			return errors.New("ip filter " + name + ":" + err.Error())
+		}
+		if _, err := parseCIDRs(f.Deny); err != nil {
+			return errors.New("ip filter " + name + ":" + err.Error())
+		}
+	}
+	for name, r := range c.RateLimits {
+		if r != nil && r.Algorithm != "" && r.Algorithm != TokenBucket && r.Algorithm != SlidingWindow {
+			return errors.New("rate limit " + name + ":unknown algorithm " + r.Algorithm)
+		}
+	}
+	if c.JWT != nil {
+		if len(c.JWT.Keys) == 0 {
+			return errors.New("jwt: no keys")
+		}
+		for _, k := range c.JWT.Keys {
+			if k == nil {
+				continue
+			}
+			if err := k.Init(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//reloadConf apply the changes of the current app config,
+//the limits of the config override the values set by the code,see applyLimits
+func reloadConf(old, c *AppConf) {
+	if !reflect.DeepEqual(old.Log, c.Log) {
+		logs.Reinit(c.Log)
+	}
+	applyLimits(c)
+	if !reflect.DeepEqual(old.TrustedProxies, c.TrustedProxies) {
+		proxies := c.TrustedProxies
+		if len(proxies) == 0 {
+			proxies = defaultTrustedProxies
+		}
+		if err := TrustedProxies(proxies...); err != nil {
+			logs.Err("trusted proxies error", err)
+		}
+	}
+	app.jwtMu.RLock()
+	jwtConf := app.jwtConf
+	app.jwtMu.RUnlock()
+	if jwtConf == old.JWT {
+		if c.JWT != nil {
+			if err := JWTInit(c.JWT); err != nil {
+				logs.Err("jwt init error", err)
+			}
+		} else {
+			app.jwtMu.Lock()
+			app.jwtConf = nil
+			app.jwtMu.Unlock()
+		}
+	}
+}
+
+//confTimeout returns the handler deadline of the config
+func confTimeout(c *AppConf) time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return 0
+}
+
+//watchConf reload the config when the file changes,
+//interval is AppConf.ConfWatch seconds,default 5,negative disables it
+func watchConf() {
+	if confWatched {
+		return
+	}
+	confWatched = true
+	c := Conf()
+	if c == nil || c.ConfWatch < 0 {
+		return
+	}
+	if fi, err := os.Stat(ConfPath()); err == nil {
+		reloadMu.Lock()
+		if confStat == nil {
+			confStat = fi
+		}
+		reloadMu.Unlock()
+	}
+	for {
+		interval := 5
+		if c := Conf(); c != nil {
+			if c.ConfWatch < 0 {
+				return
+			}
+			if c.ConfWatch > 0 {
+				interval = c.ConfWatch
+			}
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		fi, err := os.Stat(ConfPath())
+		if err != nil {
+			continue
+		}
+		reloadMu.Lock()
+		changed := confStat == nil || !fi.ModTime().Equal(confStat.ModTime()) || fi.Size() != confStat.Size()
+		reloadMu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := ReloadConf(); err != nil {
+			logs.Err("conf reload error,the old config is kept", err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadConf(t *testing.T) {
+	path := setTestConfFile(t, "config.conf", `[{"key":"reload-test","maxBodyBytes":100}]`)
+	defer applyLimits(&AppConf{})
+	var (
+		mu       sync.Mutex
+		old, new *AppConf
+	)
+	OnConfChange(func(o, n *AppConf) {
+		if n.Key == "reload-test" {
+			mu.Lock()
+			old, new = o, n
+			mu.Unlock()
+		}
+	})
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"key":"reload-test","maxBodyBytes":200}]`)
+	if err := ReloadConf(); err != nil {
+		t.Fatal(err)
+	}
+	if c := Conf(); c.MaxBodyBytes != 200 || app.maxBody() != 200 {
+		t.Fatalf("maxBodyBytes=%d,applied=%d,want 200", c.MaxBodyBytes, app.maxBody())
+	}
+	mu.Lock()
+	if old == nil || old.MaxBodyBytes != 100 || new.MaxBodyBytes != 200 {
+		t.Fatalf("OnConfChange old=%v,new=%v", old, new)
+	}
+	old, new = nil, nil
+	mu.Unlock()
+
+	invalid := []struct{ name, data, err string }{
+		{"syntax", `[{"key":"reload-test",`, ""},
+		{"log level", `[{"key":"reload-test","log":{"level":"loud"}}]`, "loud"},
+		{"trusted proxies", `[{"key":"reload-test","trustedProxies":["10.0.0.0/99"]}]`, "10.0.0.0/99"},
+		{"rate limit", `[{"key":"reload-test","rateLimits":{"a":{"algorithm":"x"}}}]`, "rate limit a"},
+		{"no app", `[]`, "no app"},
+	}
+	for _, tt := range invalid {
+		write(tt.data)
+		err := ReloadConf()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err=%v", tt.name, err)
+		}
+		if c := Conf(); c.MaxBodyBytes != 200 {
+			t.Errorf("%s: the old config is not kept", tt.name)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if new != nil {
+		t.Fatal("OnConfChange is called for a rejected config")
+	}
+}
+
+func TestRestartWorkers(t *testing.T) {
+	restart := make(chan struct{}, 1)
+	onTestControl(t, "restart", func(map[string]string) (string, error) {
+		restart <- struct{}{}
+		return "restarting", nil
+	})
+	startTestControl(t)
+	daemon, ppid := app.Daemon, flagPPid
+	defer func() { app.Daemon, flagPPid = daemon, ppid }()
+
+	//not a work process of the master
+	app.Daemon, flagPPid = false, 0
+	restartWorkers()
+	select {
+	case <-restart:
+		t.Fatal("restart is requested without a master")
+	default:
+	}
+	//the test process is the master
+	app.Daemon, flagPPid = true, os.Getpid()
+	restartWorkers()
+	select {
+	case <-restart:
+	case <-time.After(time.Second):
+		t.Fatal("restart is not requested")
+	}
+}
@@ -3,16 +3,19 @@
 package bast
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aixiaoxiang/bast/guid"
 	"github.com/aixiaoxiang/bast/ids"
@@ -23,15 +26,21 @@ import (
 
 //const code
 const (
-	SerError                = 0      // error code
-	SerOK                   = 1      // ok code
-	SerDBError              = -10000 // db error code
-	SerNoDataError          = -20000 // no data error code
-	SerSignOutError         = -30000 // user sign out error code
-	SerUserNotExistError    = -40000 // user not exist code
-	SerInvalidParamError    = -50000 // invalid param  code
-	SerInvalidUserAuthorize = -60000 // invalid user authorize  code
-	SerExist                = -70000 // exist code
+	SerError                = 0       // error code
+	SerOK                   = 1       // ok code
+	SerDBError              = -10000  // db error code
+	SerNoDataError          = -20000  // no data error code
+	SerSignOutError         = -30000  // user sign out error code
+	SerUserNotExistError    = -40000  // user not exist code
+	SerInvalidParamError    = -50000  // invalid param  code
+	SerInvalidUserAuthorize = -60000  // invalid user authorize  code
+	SerExist                = -70000  // exist code
+	SerRequestTooLargeError = -80000  // request body too large code
+	SerTimeoutError         = -90000  // request timeout code
+	SerPermissionDenied     = -100000 // permission denied code
+	SerCSRFError            = -110000 // csrf token error code
+	SerRateLimitError       = -120000 // rate limit exceeded code
+	SerIPDenied             = -130000 // ip denied code
 )
 
 //Context is app Context
@@ -50,6 +59,13 @@ type Context struct {
 	Params httprouter.Params
 	//isParseForm Parse tag
 	isParseForm bool
+	//keys request-scoped values,see Set/Get
+	keys map[string]interface{}
+	mu   sync.RWMutex
+	//route current route
+	route *Route
+	//writer wrap ResponseWriter
+	writer responseWriter
 }
 
 //Msgs 响应消息基本结构
@@ -143,7 +159,7 @@ func (c *Context) JSONResult(v interface{}) {
 		return
 	}
 	c.ResponseWriter.Header().Set("Content-Type", "application/json")
-	c.ResponseWriter.Write(data)
+	c.write(data)
 	// fmt.Fprintln(c.ResponseWriter, data)
 	data = nil
 }
@@ -206,6 +222,18 @@ func (c *Context) FailResult(msg string, errCode int, err ...error) {
 	d = nil
 }
 
+//FailResultWithStatus 输出带http状态码的通用错误消息
+//param:
+//	statusCode http状态码
+//	msg 失败/错误消息
+//	errCode 失败/错误代码
+func (c *Context) FailResultWithStatus(statusCode int, msg string, errCode int) {
+	if errCode == 0 {
+		errCode = SerError
+	}
+	writeFail(c.ResponseWriter, statusCode, msg, errCode)
+}
+
 //NoData 输出无数据消息
 //param:
 //	err 消息
@@ -219,20 +247,28 @@ func (c *Context) NoData(msg ...string) {
 	c.FailResult(msgs, SerNoDataError)
 }
 
-//Say 输出字节流数据
+//Say 输出字节流数据,可能分多次输出所以不设置ETag,完整的响应数据用SayAll
 //param:
 //	data 数据
 func (c *Context) Say(data []byte) {
 	c.ResponseWriter.Write(data)
 }
 
-//SayStr 输出字符串信息
+//SayStr 输出字符串信息,不设置ETag,完整的响应数据用SayAll
 //param:
 //	str 消息
 func (c *Context) SayStr(str string) {
 	c.ResponseWriter.Write([]byte(str))
 }
 
+//SayAll 输出完整的响应数据,GET/HEAD请求自动设置弱ETag并处理If-None-Match,
+//之后不能再有输出
+//param:
+//	data 完整的响应数据
+func (c *Context) SayAll(data []byte) {
+	c.write(data)
+}
+
 //SendFile 发送文件
 //param:
 //	fileName 文件全路径
@@ -240,11 +276,20 @@ func (c *Context) SayStr(str string) {
 func (c *Context) SendFile(fileName string, rawFileName ...string) {
 	dir := filepath.Dir(fileName)
 	fileName = filepath.Base(fileName)
-	url := c.BaseURL("f/" + fileName)
+	//the prefix of BaseUrl header would break StripPrefix,use the scheme and host only
+	url := c.baseURL() + "/f/" + fileName
 	fileName = "/f/" + fileName
 	fs := http.StripPrefix("/f/", http.FileServer(http.Dir(dir)))
 	r, _ := http.NewRequest("GET", url, nil)
+	for _, k := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if v := c.Request.Header.Get(k); v != "" {
+			r.Header.Set(k, v)
+		}
+	}
 	raw := fileName
+	if fi, err := os.Stat(filepath.Join(dir, filepath.Base(fileName))); err == nil && !fi.IsDir() {
+		c.ResponseWriter.Header().Set("ETag", fileETag(fi))
+	}
 	if rawFileName != nil {
 		raw = rawFileName[0]
 		c.ResponseWriter.Header().Set("Content-Disposition", "attachment; filename="+raw)
@@ -287,6 +332,7 @@ func (c *Context) StatusCode(statusCode int) {
 func (c *Context) GetRawStr() string {
 	body, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
+		c.bodyError(err)
 		return ""
 	}
 	return string(body)
@@ -581,13 +627,13 @@ func (c *Context) GetJSON(obj interface{}) error {
 func (c *Context) JSONDecode(r io.Reader, obj interface{}) error {
 	body, err := ioutil.ReadAll(r)
 	if err != nil {
-		return err
+		return c.bodyError(err)
 	}
 	err = json.Unmarshal(body, obj)
 	// logs.Debug("JSONDecode=" + string(body))
 	if err != nil {
 		if app.Debug {
-			logs.Debug("JSONDecode-Err=" + err.Error() + ",detail=" + string(body))
+			logs.Debug("JSONDecode-Err=" + err.Error() + ",detail=" + logs.RedactText(string(body)))
 		} else {
 			logs.Debug("JSONDecode-Err=" + err.Error())
 		}
@@ -597,6 +643,19 @@ func (c *Context) JSONDecode(r io.Reader, obj interface{}) error {
 	return err
 }
 
+//bodyError 请求体超过MaxBodyBytes时输出413及SerRequestTooLargeError,
+//之后处理程序的输出被丢弃,响应不依赖处理程序如何处理该错误
+//param:
+//	err 读取请求体的错误
+func (c *Context) bodyError(err error) error {
+	if isBodyTooLarge(err) {
+		c.writer.abort(http.StatusRequestEntityTooLarge, func(rw http.ResponseWriter) {
+			writeFail(rw, http.StatusRequestEntityTooLarge, "请求体过大", SerRequestTooLargeError)
+		})
+	}
+	return err
+}
+
 //XMLObj 将当前请求流XML格式转化为对象
 //param:
 //	obj 外部对象
@@ -618,12 +677,12 @@ func (c *Context) GetXML(obj interface{}) error {
 func (c *Context) XMLDecode(r io.Reader, obj interface{}) error {
 	body, err := ioutil.ReadAll(r)
 	if err != nil {
-		return err
+		return c.bodyError(err)
 	}
 	err = xml.Unmarshal(body, obj)
 	if err != nil {
 		if app.Debug {
-			logs.Debug("XMLDecode-Err=" + err.Error() + ",detail=" + string(body))
+			logs.Debug("XMLDecode-Err=" + err.Error() + ",detail=" + logs.RedactText(string(body)))
 		} else {
 			logs.Debug("XMLDecode-Err=" + err.Error())
 		}
@@ -635,9 +694,13 @@ func (c *Context) XMLDecode(r io.Reader, obj interface{}) error {
 
 //MapObj 将请求流转化为字典对象
 func (c *Context) MapObj() map[string]interface{} {
-	body, _ := ioutil.ReadAll(c.Request.Body)
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.bodyError(err)
+		return nil
+	}
 	result := make(map[string]interface{})
-	err := json.Unmarshal([]byte(body), &result)
+	err = json.Unmarshal([]byte(body), &result)
 	if err == nil {
 		return result
 	}
@@ -662,27 +725,63 @@ func (c *Context) ParseMultipartForm(maxMemory int64) error {
 
 //URL 获取请求的完整URL
 func (c *Context) URL() string {
-	return strings.Join([]string{c.BaseURL(), c.Request.RequestURI}, "")
+	return strings.TrimSuffix(c.BaseURL(), "/") + c.Request.URL.RequestURI()
 }
 
 //BaseURL 获取请求的基URL
 //param:
 //	url 相对地址
 func (c *Context) BaseURL(url ...string) string {
-	baseURL := c.Request.Header.Get("BaseUrl")
-	if baseURL != "" {
-		return baseURL + strings.Join(url, "")
+	if c.fromTrustedProxy() {
+		if baseURL := c.Request.Header.Get("BaseUrl"); baseURL != "" {
+			return baseURL + strings.Join(url, "")
+		}
 	}
 	return c.baseURL() + "/" + strings.Join(url, "")
 }
 
 //baseURL 获取请求的基URL-内部使用
 func (c *Context) baseURL() string {
-	scheme := "http://"
+	return strings.Join([]string{c.Scheme(), "://", c.Host()}, "")
+}
+
+//Scheme 获取请求的协议,http或https,
+//来自可信代理(见TrustedProxies)时使用Forwarded/X-Forwarded-Proto,取最右侧(最近的代理追加的)值
+func (c *Context) Scheme() string {
 	if c.Request.TLS != nil {
-		scheme = "https://"
+		return "https"
 	}
-	return strings.Join([]string{scheme, c.Request.Host}, "")
+	if c.fromTrustedProxy() {
+		if e, i := forwarded(c.Request); i >= 0 && e.Proto != "" {
+			return e.Proto
+		}
+		if proto := lastHeaderValue(c.Request.Header, "X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(proto)
+		}
+		if strings.EqualFold(c.Request.Header.Get("X-Forwarded-Ssl"), "on") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+//Host 获取请求的主机名(含端口),
+//来自可信代理(见TrustedProxies)时使用Forwarded/X-Forwarded-Host,取最右侧(最近的代理追加的)值
+func (c *Context) Host() string {
+	if c.fromTrustedProxy() {
+		if e, i := forwarded(c.Request); i >= 0 && e.Host != "" {
+			return e.Host
+		}
+		if host := lastHeaderValue(c.Request.Header, "X-Forwarded-Host"); host != "" {
+			return host
+		}
+	}
+	return c.Request.Host
+}
+
+//IsHTTPS 是否https请求
+func (c *Context) IsHTTPS() bool {
+	return c.Scheme() == "https"
 }
 
 //Redirect 重定向
@@ -690,25 +789,17 @@ func (c *Context) Redirect(url string) {
 	http.Redirect(c.ResponseWriter, c.Request, url, http.StatusFound)
 }
 
-//ClientIP return request client ip
+//ClientIP return request client ip,
+//the forwarded headers are honored only from trusted proxies(see TrustedProxies),
+//the right-most untrusted address of the chain is the client
 func (c *Context) ClientIP() string {
-	ps := c.Proxys()
-	if len(ps) > 0 && ps[0] != "" {
-		realIP, _, err := net.SplitHostPort(ps[0])
-		if err != nil {
-			realIP = ps[0]
-		}
-		return realIP
-	}
-	if ip, _, err := net.SplitHostPort(c.Request.RemoteAddr); err == nil {
-		return ip
-	}
-	return c.Request.RemoteAddr
+	return clientIP(c.Request)
 }
 
 // Proxys return request proxys
 // if request header has X-Real-IP, return it
 // if request header has X-Forwarded-For, return it
+// the values are sent by the client or proxies and are not verified, see ClientIP
 func (c *Context) Proxys() []string {
 	if v := c.Request.Header.Get("X-Real-IP"); v != "" {
 		return strings.Split(v, ",")
@@ -733,34 +824,322 @@ func (c *Context) Reset() {
 	c.Out = nil
 	c.Params = nil
 	c.isParseForm = false
+	c.route = nil
+	c.mu.Lock()
+	c.keys = nil
+	c.mu.Unlock()
+}
+
+//init 初始化请求与响应对象
+func (c *Context) init(w http.ResponseWriter, r *http.Request) {
+	c.writer.reset(w)
+	c.Request = r
+	c.In = r
+	c.ResponseWriter = &c.writer
+	c.Out = c.ResponseWriter
+}
+
+//Route 获取当前请求的路由
+func (c *Context) Route() *Route {
+	return c.route
+}
+
+/******request-scoped value method **********/
+
+//Set 保存当前请求范围内的值(如认证用户、租户、请求ID)
+//param:
+//	key 键值
+//	value 值
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	if c.keys == nil {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[key] = value
+	c.mu.Unlock()
+}
+
+//Get 获取当前请求范围内的值
+//param:
+//	key 键值
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	value, exists = c.keys[key]
+	c.mu.RUnlock()
+	return
+}
+
+//MustGet 获取当前请求范围内的值,不存在则panic
+//param:
+//	key 键值
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("key \"" + key + "\" does not exist")
+}
+
+//ValueString 获取当前请求范围内的值并转化为string
+//param:
+//	key 键值
+func (c *Context) ValueString(key string) (s string) {
+	if v, ok := c.Get(key); ok && v != nil {
+		s, _ = v.(string)
+	}
+	return
+}
+
+//ValueInt 获取当前请求范围内的值并转化为int
+//param:
+//	key 键值
+func (c *Context) ValueInt(key string) (i int) {
+	if v, ok := c.Get(key); ok && v != nil {
+		i, _ = v.(int)
+	}
+	return
+}
+
+//ValueInt64 获取当前请求范围内的值并转化为int64
+//param:
+//	key 键值
+func (c *Context) ValueInt64(key string) (i int64) {
+	if v, ok := c.Get(key); ok && v != nil {
+		i, _ = v.(int64)
+	}
+	return
+}
+
+//ValueFloat 获取当前请求范围内的值并转化为float64
+//param:
+//	key 键值
+func (c *Context) ValueFloat(key string) (f float64) {
+	if v, ok := c.Get(key); ok && v != nil {
+		f, _ = v.(float64)
+	}
+	return
+}
+
+//ValueBool 获取当前请求范围内的值并转化为bool
+//param:
+//	key 键值
+func (c *Context) ValueBool(key string) (b bool) {
+	if v, ok := c.Get(key); ok && v != nil {
+		b, _ = v.(bool)
+	}
+	return
+}
+
+//ValueTime 获取当前请求范围内的值并转化为time.Time
+//param:
+//	key 键值
+func (c *Context) ValueTime(key string) (t time.Time) {
+	if v, ok := c.Get(key); ok && v != nil {
+		t, _ = v.(time.Time)
+	}
+	return
+}
+
+//ValueStrings 获取当前请求范围内的值并转化为[]string
+//param:
+//	key 键值
+func (c *Context) ValueStrings(key string) (ss []string) {
+	if v, ok := c.Get(key); ok && v != nil {
+		ss, _ = v.([]string)
+	}
+	return
+}
+
+//Keys 获取当前请求范围内的所有值(副本)
+func (c *Context) Keys() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.keys == nil {
+		return nil
+	}
+	keys := make(map[string]interface{}, len(c.keys))
+	for k, v := range c.keys {
+		keys[k] = v
+	}
+	return keys
+}
+
+/******context.Context method **********/
+// *Context 实现了context.Context(Err见context_err.go),可以直接传给数据库或http客户端等,
+// 请求结束后取消,可以在其它goroutine中继续持有
+
+//context 当前请求的context.Context
+func (c *Context) context() context.Context {
+	if c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
+//Deadline see context.Context Deadline
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.context().Deadline()
+}
+
+//Done see context.Context Done,客户端断开或超时关闭
+func (c *Context) Done() <-chan struct{} {
+	return c.context().Done()
+}
+
+//Value see context.Context Value,
+//key为string时优先从Set的值中查找
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, exists := c.Get(k); exists {
+			return v
+		}
+	}
+	return c.context().Value(key)
+}
+
+//WithValue 设置当前请求的context值(可在Value中获取)
+//param:
+//	key 键值
+//	val 值
+func (c *Context) WithValue(key, val interface{}) {
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), key, val))
+		c.In = c.Request
+	}
+}
+
+/******cookie method **********/
+
+//Cookie 获取指定名称的cookie值,不存在则返回空字符串
+//param:
+//	name cookie名称
+func (c *Context) Cookie(name string) string {
+	ck, err := c.Request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	v, err := url.QueryUnescape(ck.Value)
+	if err != nil {
+		return ck.Value
+	}
+	return v
+}
+
+//CookieOption SetCookie的选项
+type CookieOption int
+
+const (
+	//CookieScript 不设置HttpOnly,cookie可以被脚本读取(如CSRF令牌)
+	CookieScript CookieOption = iota + 1
+	//CookieInsecure 仅在https请求或SameSite=None时设置Secure,用于同时支持http的站点
+	CookieInsecure
+)
+
+//SetCookie 设置cookie,默认 Path=/,未设置SameSite时默认SameSite=Lax,
+//总是设置HttpOnly与Secure,除非使用CookieScript或CookieInsecure选项
+//param:
+//	cookie cookie对象
+//	opts 选项
+func (c *Context) SetCookie(cookie *http.Cookie, opts ...CookieOption) {
+	httpOnly, secure := true, true
+	for _, o := range opts {
+		switch o {
+		case CookieScript:
+			httpOnly = false
+		case CookieInsecure:
+			secure = false
+		}
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if httpOnly {
+		cookie.HttpOnly = true
+	}
+	if secure || cookie.SameSite == http.SameSiteNoneMode || c.IsHTTPS() {
+		//SameSite=None requires Secure
+		cookie.Secure = true
+	}
+	cookie.Value = url.QueryEscape(cookie.Value)
+	setCookie(c.ResponseWriter.Header(), cookie)
+}
+
+//SetCookieValue 快捷设置cookie
+//param:
+//	name cookie名称
+//	value cookie值
+//	maxAge 有效期(秒),0为会话cookie,小于0为删除
+//	opts 选项,见SetCookie
+func (c *Context) SetCookieValue(name, value string, maxAge int, opts ...CookieOption) {
+	c.SetCookie(&http.Cookie{Name: name, Value: value, MaxAge: maxAge}, opts...)
+}
+
+//DeleteCookie 删除cookie
+//param:
+//	name cookie名称
+func (c *Context) DeleteCookie(name string) {
+	//http站点不能设置Secure的cookie,删除时不强制Secure
+	c.SetCookie(&http.Cookie{Name: name, MaxAge: -1, Expires: time.Unix(1, 0)}, CookieInsecure)
+}
+
+//setCookie add Set-Cookie,replace the previous one with the same name
+func setCookie(h http.Header, cookie *http.Cookie) {
+	prefix := cookie.Name + "="
+	cs := h["Set-Cookie"]
+	for i := 0; i < len(cs); i++ {
+		if strings.HasPrefix(cs[i], prefix) {
+			cs = append(cs[:i], cs[i+1:]...)
+			i--
+		}
+	}
+	if v := cookie.String(); v != "" {
+		cs = append(cs, v)
+	}
+	if len(cs) == 0 {
+		h.Del("Set-Cookie")
+	} else {
+		h["Set-Cookie"] = cs
+	}
 }
 
 /******log method **********/
 
 //I info日志记录
 func (c *Context) I(msg string, fields ...zap.Field) {
-	logs.I(msg, fields...)
+	logs.I(msg, c.logFields(fields)...)
 }
 
 //D debug日志记录
 func (c *Context) D(msg string, fields ...zap.Field) {
-	logs.D(msg, fields...)
+	logs.D(msg, c.logFields(fields)...)
 }
 
 //E Error日志记录
 func (c *Context) E(msg string, fields ...zap.Field) {
-	logs.E(msg, fields...)
+	logs.E(msg, c.logFields(fields)...)
 }
 
-//Err Error日志记录
-func (c *Context) Err(msg string, err error) {
+//LogErr Error日志记录
+//说明：原Err(msg, err)方法与context.Context的Err() error冲突,已改名为LogErr,
+//迁移期间可以使用-tags bast_legacyerr编译保留原Err(msg, err),见CHANGELOG.md
+func (c *Context) LogErr(msg string, err error) {
 	if msg == "" {
 		msg = "发生错误"
 	}
 	if err != nil {
 		msg += "，详情：" + err.Error()
 	}
-	logs.E(msg)
+	logs.E(msg, c.logFields(nil)...)
+}
+
+//logFields attach the request id
+func (c *Context) logFields(fields []zap.Field) []zap.Field {
+	if c.Request == nil {
+		return fields
+	}
+	return logs.WithRequestID(c.Request.Context(), fields...)
 }
 
 /******ID method **********/
@@ -0,0 +1,14 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build !bast_legacyerr
+
+package bast
+
+import "context"
+
+var _ context.Context = (*Context)(nil)
+
+//Err see context.Context Err,返回请求被取消或超时的原因
+func (c *Context) Err() error {
+	return c.context().Err()
+}
@@ -0,0 +1,12 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+// +build bast_legacyerr
+
+package bast
+
+//Err Error日志记录,使用-tags bast_legacyerr编译时保留,此时*Context不实现context.Context
+//
+//Deprecated: 请使用LogErr,下一个版本将移除bast_legacyerr
+func (c *Context) Err(msg string, err error) {
+	c.LogErr(msg, err)
+}
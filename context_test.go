@@ -0,0 +1,96 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextValues(t *testing.T) {
+	ctx := &Context{}
+	ctx.init(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	now := time.Now()
+	ctx.Set("s", "v")
+	ctx.Set("i", 1)
+	ctx.Set("i64", int64(2))
+	ctx.Set("f", 1.5)
+	ctx.Set("b", true)
+	ctx.Set("t", now)
+	ctx.Set("ss", []string{"a"})
+	ctx.Set("nil", nil)
+	if v, ok := ctx.Get("s"); !ok || v != "v" {
+		t.Fatalf("Get=%v,%v", v, ok)
+	}
+	if _, ok := ctx.Get("none"); ok {
+		t.Fatal("Get returns a missing key")
+	}
+	if _, ok := ctx.Get("nil"); !ok {
+		t.Fatal("Get doesn't return the nil value")
+	}
+	if ctx.ValueString("s") != "v" || ctx.ValueInt("i") != 1 || ctx.ValueInt64("i64") != 2 ||
+		ctx.ValueFloat("f") != 1.5 || !ctx.ValueBool("b") || !ctx.ValueTime("t").Equal(now) ||
+		len(ctx.ValueStrings("ss")) != 1 {
+		t.Fatal("the typed values don't match")
+	}
+	//the wrong type returns the zero value
+	if ctx.ValueInt("s") != 0 || ctx.ValueString("i") != "" || ctx.ValueString("nil") != "" {
+		t.Fatal("the wrong type doesn't return the zero value")
+	}
+	if ctx.MustGet("s") != "v" {
+		t.Fatal("MustGet")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("MustGet doesn't panic for a missing key")
+			}
+		}()
+		ctx.MustGet("none")
+	}()
+	//string keys of Value are looked up in the values first
+	if ctx.Value("s") != "v" {
+		t.Fatal("Value doesn't return the value of Set")
+	}
+	keys := ctx.Keys()
+	keys["s"] = "changed"
+	if ctx.ValueString("s") != "v" {
+		t.Fatal("Keys doesn't return a copy")
+	}
+	ctx.Reset()
+	if _, ok := ctx.Get("s"); ok || ctx.Keys() != nil || ctx.Request != nil {
+		t.Fatal("Reset doesn't clear the values")
+	}
+}
+
+func TestContextHeld(t *testing.T) {
+	held := make(chan *Context, 2)
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		ctx.Set("id", ctx.GetString("id"))
+		held <- ctx
+		ctx.JSON("ok")
+	}))
+	for _, id := range []string{"1", "2"} {
+		res, err := http.Get(srv.URL + "/test?id=" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	first, second := <-held, <-held
+	if first == second || first.ValueString("id") != "1" || second.ValueString("id") != "2" {
+		t.Fatal("the Context is reused by another request")
+	}
+	//the Context is canceled after the request
+	select {
+	case <-first.Done():
+		if first.context().Err() != context.Canceled {
+			t.Fatal("err=", first.context().Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the Context isn't canceled after the request")
+	}
+}
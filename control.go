@@ -0,0 +1,158 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"github.com/aixiaoxiang/bast/pipe"
+)
+
+//controlMsg master->worker control message,or the restart request of the worker to the master
+type controlMsg struct {
+	Cmd string `json:"cmd"`
+	//AppKey only the worker of the app handles it,empty means all
+	AppKey string            `json:"appKey,omitempty"`
+	Args   map[string]string `json:"args,omitempty"`
+}
+
+//controlReply worker reply
+type controlReply struct {
+	OK  bool   `json:"ok"`
+	Msg string `json:"msg,omitempty"`
+}
+
+var (
+	controlMu       sync.Mutex
+	controlHandlers = map[string]func(args map[string]string) (string, error){
+		"rotate": func(map[string]string) (string, error) {
+			return "rotated", logs.Rotate()
+		},
+	}
+	controlListener net.Listener
+)
+
+//onControl registers the handler of the control command
+func onControl(cmd string, f func(args map[string]string) (string, error)) {
+	controlMu.Lock()
+	controlHandlers[cmd] = f
+	controlMu.Unlock()
+}
+
+//controlName returns the control pipe name of the master or worker
+func controlName(pid int) string {
+	return "bast-" + strconv.Itoa(pid)
+}
+
+//masterControl the master listens the control pipe for the restart requests of the workers
+func masterControl() {
+	onControl("restart", restartMaster)
+	go controlListen()
+}
+
+//controlListen the master or worker listens the control pipe
+func controlListen() {
+	name := controlName(os.Getpid())
+	pipe.Remove(name)
+	l, err := pipe.Listen(name)
+	if err != nil {
+		logs.Err("control listen error", err)
+		return
+	}
+	controlMu.Lock()
+	controlListener = l
+	controlMu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go handleControl(conn)
+	}
+}
+
+//controlClose close the control pipe
+func controlClose() {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+	if controlListener != nil {
+		controlListener.Close()
+		controlListener = nil
+		pipe.Remove(controlName(os.Getpid()))
+	}
+}
+
+//handleControl handle a control message
+func handleControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	msg := &controlMsg{}
+	reply := &controlReply{}
+	if err := json.NewDecoder(conn).Decode(msg); err != nil {
+		reply.Msg = err.Error()
+	} else if msg.AppKey != "" && msg.AppKey != flagAppKey {
+		reply.OK = true
+		reply.Msg = "skipped,appkey=" + flagAppKey
+	} else {
+		controlMu.Lock()
+		f := controlHandlers[msg.Cmd]
+		controlMu.Unlock()
+		if f == nil {
+			reply.Msg = "unknown command " + msg.Cmd
+		} else if m, err := f(msg.Args); err != nil {
+			reply.Msg = err.Error()
+		} else {
+			reply.OK = true
+			reply.Msg = m
+		}
+		logs.Info("control cmd=" + msg.Cmd + ",ok=" + strconv.FormatBool(reply.OK) + ",msg=" + reply.Msg)
+	}
+	json.NewEncoder(conn).Encode(reply)
+}
+
+//sendControl send the message to the worker
+func sendControl(pid int, msg *controlMsg) (*controlReply, error) {
+	conn, err := pipe.Dial(controlName(pid))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		return nil, err
+	}
+	reply := &controlReply{}
+	if err := json.NewDecoder(conn).Decode(reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+//broadcastControl send the message to all workers and print the replies
+func broadcastControl(msg *controlMsg) error {
+	pids := getWorkPids()
+	if len(pids) == 0 {
+		return errors.New("no running work process")
+	}
+	for _, pid := range pids {
+		reply, err := sendControl(pid, msg)
+		if err != nil {
+			fmt.Println("pid=" + strconv.Itoa(pid) + ",error=" + err.Error())
+			continue
+		}
+		if reply.OK {
+			fmt.Println("pid=" + strconv.Itoa(pid) + ",ok," + reply.Msg)
+		} else {
+			fmt.Println("pid=" + strconv.Itoa(pid) + ",error=" + reply.Msg)
+		}
+	}
+	return nil
+}
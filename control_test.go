@@ -0,0 +1,88 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//startTestControl listen the control pipe of the test process,it's closed after the test
+func startTestControl(t *testing.T) {
+	go controlListen()
+	for i := 0; ; i++ {
+		controlMu.Lock()
+		l := controlListener
+		controlMu.Unlock()
+		if l != nil {
+			break
+		}
+		if i > 100 {
+			t.Fatal("control pipe is not listened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(controlClose)
+}
+
+//onTestControl registers the handler of the control command,the old one is restored after the test
+func onTestControl(t *testing.T, cmd string, f func(args map[string]string) (string, error)) {
+	controlMu.Lock()
+	old, ok := controlHandlers[cmd]
+	controlMu.Unlock()
+	onControl(cmd, f)
+	t.Cleanup(func() {
+		controlMu.Lock()
+		if ok {
+			controlHandlers[cmd] = old
+		} else {
+			delete(controlHandlers, cmd)
+		}
+		controlMu.Unlock()
+	})
+}
+
+func TestControl(t *testing.T) {
+	onTestControl(t, "echo", func(args map[string]string) (string, error) {
+		return args["v"], nil
+	})
+	dir := t.TempDir()
+	setTestLog(t, &logs.LogConf{OutPath: filepath.Join(dir, "app.log")})
+	startTestControl(t)
+	appKey := flagAppKey
+	defer func() { flagAppKey = appKey }()
+	flagAppKey = "control-test"
+
+	tests := []struct {
+		name string
+		msg  *controlMsg
+		ok   bool
+		want string
+	}{
+		{"echo", &controlMsg{Cmd: "echo", Args: map[string]string{"v": "hi"}}, true, "hi"},
+		{"app", &controlMsg{Cmd: "echo", AppKey: "control-test", Args: map[string]string{"v": "app"}}, true, "app"},
+		{"other app", &controlMsg{Cmd: "echo", AppKey: "other", Args: map[string]string{"v": "x"}}, true, "skipped,appkey=control-test"},
+		{"unknown", &controlMsg{Cmd: "nope"}, false, "unknown command nope"},
+		{"rotate", &controlMsg{Cmd: "rotate"}, true, "rotated"},
+	}
+	for _, tt := range tests {
+		reply, err := sendControl(os.Getpid(), tt.msg)
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+		if reply.OK != tt.ok || reply.Msg != tt.want {
+			t.Errorf("%s: reply=%+v", tt.name, reply)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(files) != 1 {
+		t.Fatalf("rotated files=%v", files)
+	}
+	controlClose()
+	if _, err := sendControl(os.Getpid(), &controlMsg{Cmd: "echo"}); err == nil {
+		t.Fatal("the closed control pipe is connected")
+	}
+}
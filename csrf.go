@@ -0,0 +1,236 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+const (
+	//csrfCtxKey the request store key of the CSRF token
+	csrfCtxKey = "bast.csrf"
+	//csrfCheckerKey the request store key of the CSRF checker,SignIn and SignOut refresh the token with it
+	csrfCheckerKey = "bast.csrf.checker"
+	//csrfSessionKey the session key of the secret the token is bound to
+	csrfSessionKey = "bast.csrf"
+)
+
+//CSRFConf CSRF config
+type CSRFConf struct {
+	//Secret the key signing the token,a random key is used if empty(tokens don't survive restarts)
+	Secret string `json:"secret"`
+	//Cookie token cookie name,default "bast_csrf",it's readable by scripts
+	Cookie string `json:"cookie"`
+	//Header request header carrying the token,default "X-CSRF-Token"
+	Header string `json:"header"`
+	//Field form field carrying the token,default "_csrf"
+	Field string `json:"field"`
+	//TTL cookie lifetime(seconds),default 86400
+	TTL int `json:"ttl"`
+	//ExemptPaths paths not checked,a trailing "*" matches the prefix
+	ExemptPaths []string `json:"exemptPaths"`
+}
+
+//csrf CSRF checker
+type csrf struct {
+	conf CSRFConf
+	key  []byte
+}
+
+//CSRF returns the signed double-submit cookie CSRF middleware,
+//unsafe methods(POST,PUT,DELETE...) must send the token of the cookie in the header
+//or the field of a urlencoded form,multipart forms must use the header,
+//the token cookie is set by ctx.CSRFToken(),it's bound to the session if the request has one,
+//SignIn and SignOut issue a new token,
+//requests with a valid JWT bearer token in the Authorization header are not cookie authenticated and skip the check,
+//it replies SerCSRFError with 403 if the check fails,
+//conf nil uses AppConf.CSRF
+//	bast.Use(bast.CSRF(nil))
+//	//SPA: call a route using ctx.CSRFToken(),then read the cookie and send it as X-CSRF-Token
+func CSRF(conf *CSRFConf) Middleware {
+	if conf == nil {
+		if c := Conf(); c != nil && c.CSRF != nil {
+			conf = c.CSRF
+		} else {
+			conf = &CSRFConf{}
+		}
+	}
+	x := &csrf{conf: *conf}
+	if x.conf.Cookie == "" {
+		x.conf.Cookie = "bast_csrf"
+	}
+	if x.conf.Header == "" {
+		x.conf.Header = "X-CSRF-Token"
+	}
+	if x.conf.Field == "" {
+		x.conf.Field = "_csrf"
+	}
+	if x.conf.TTL <= 0 {
+		x.conf.TTL = 86400
+	}
+	if x.conf.Secret != "" {
+		k := sha256.Sum256([]byte(x.conf.Secret))
+		x.key = k[:]
+	} else {
+		x.key = make([]byte, 32)
+		rand.Read(x.key)
+	}
+	return x.handle
+}
+
+func (x *csrf) handle(ctx *Context, next func(ctx *Context)) {
+	req := ctx.Request
+	ctx.Set(csrfCheckerKey, x)
+	if x.exempt(req) {
+		next(ctx)
+		return
+	}
+	token := ctx.Cookie(x.conf.Cookie)
+	binding, ok := x.binding(ctx, false)
+	valid := ok && x.valid(token, binding)
+	sent := req.Header.Get(x.conf.Header)
+	if sent == "" && formContent(req) {
+		sent = req.PostFormValue(x.conf.Field)
+	}
+	if !valid || sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		logs.Info("csrf check failed,method=" + req.Method + ",uri=" + req.RequestURI)
+		ctx.FailResultWithStatus(http.StatusForbidden, "CSRF令牌验证失败,请刷新页面后重试", SerCSRFError)
+		return
+	}
+	ctx.Set(csrfCtxKey, token)
+	next(ctx)
+}
+
+//formContent returns true if the request body is a urlencoded form
+func formContent(req *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return ct == "application/x-www-form-urlencoded"
+}
+
+//token returns the valid token of the request,a new token cookie is set if it's absent or invalid
+func (x *csrf) token(ctx *Context) string {
+	binding, _ := x.binding(ctx, true)
+	token := ctx.Cookie(x.conf.Cookie)
+	if !x.valid(token, binding) {
+		token = x.issue(ctx, binding)
+	}
+	ctx.Set(csrfCtxKey, token)
+	return token
+}
+
+//issue set a new token cookie bound to binding
+func (x *csrf) issue(ctx *Context, binding string) string {
+	token := x.newToken(binding)
+	ctx.SetCookie(&http.Cookie{
+		Name:     x.conf.Cookie,
+		Value:    token,
+		MaxAge:   x.conf.TTL,
+		SameSite: http.SameSiteLaxMode,
+	}, CookieScript, CookieInsecure)
+	return token
+}
+
+//binding returns the secret of the session the token is bound to,
+//empty if the request has no session,the secret is created if create is true,
+//ok is false if the session has no secret
+func (x *csrf) binding(ctx *Context, create bool) (string, bool) {
+	var s *Session
+	if v, ok := ctx.Get(sessionCtxKey); ok {
+		s = v.(*Session)
+	} else if ctx.Cookie(sessionConf().Name) != "" {
+		s = ctx.Session()
+	}
+	if s == nil || s.IsNew {
+		return "", true
+	}
+	secret, _ := s.Get(csrfSessionKey).(string)
+	if secret != "" {
+		return secret, true
+	}
+	if !create {
+		return "", false
+	}
+	b := make([]byte, 24)
+	rand.Read(b)
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	if err := s.Set(csrfSessionKey, secret); err != nil {
+		logs.Err("csrf session secret save error", err)
+		return "", true
+	}
+	return secret, true
+}
+
+//refreshCSRF issue a new token after the session changes,such as sign in
+func refreshCSRF(ctx *Context) {
+	if v, ok := ctx.Get(csrfCheckerKey); ok {
+		x := v.(*csrf)
+		binding, _ := x.binding(ctx, true)
+		ctx.Set(csrfCtxKey, x.issue(ctx, binding))
+	}
+}
+
+//exempt returns true if the request doesn't need the check
+func (x *csrf) exempt(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	//only a verified bearer token,an arbitrary Authorization header can be sent cross-site with the cookies
+	if auth := req.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		if _, err := ParseToken(strings.TrimSpace(auth[7:])); err == nil {
+			return true
+		}
+	}
+	for _, p := range x.conf.ExemptPaths {
+		if p == req.URL.Path || (strings.HasSuffix(p, "*") && strings.HasPrefix(req.URL.Path, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+//newToken returns nonce.signature,the signature covers the binding
+func (x *csrf) newToken(binding string) string {
+	nonce := make([]byte, 24)
+	rand.Read(nonce)
+	n := base64.RawURLEncoding.EncodeToString(nonce)
+	return n + "." + x.sign(n, binding)
+}
+
+//valid verify the token signature
+func (x *csrf) valid(token, binding string) bool {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return false
+	}
+	return hmac.Equal([]byte(token[i+1:]), []byte(x.sign(token[:i], binding)))
+}
+
+func (x *csrf) sign(nonce, binding string) string {
+	m := hmac.New(sha256.New, x.key)
+	m.Write([]byte(nonce))
+	m.Write([]byte{0})
+	m.Write([]byte(binding))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+//CSRFToken 获取当前请求的CSRF令牌,用于模板表单字段或前端请求头,
+//令牌不存在或无效时创建并设置Cookie,未启用CSRF中间件返回空
+func (c *Context) CSRFToken() string {
+	if token := c.ValueString(csrfCtxKey); token != "" {
+		return token
+	}
+	if v, ok := c.Get(csrfCheckerKey); ok {
+		return v.(*csrf).token(c)
+	}
+	return ""
+}
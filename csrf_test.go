@@ -0,0 +1,174 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aixiaoxiang/bast/jwt"
+)
+
+//countStore counts the session loads
+type countStore struct {
+	*MemoryStore
+	loads int32
+}
+
+func (s *countStore) Load(ctx *Context, conf *SessionConf) (*Session, error) {
+	atomic.AddInt32(&s.loads, 1)
+	return s.MemoryStore.Load(ctx, conf)
+}
+
+//csrfTestServer serve a route with the CSRF middleware,
+//?h=token replies the token,?h=signin signs in the user u
+func csrfTestServer(t *testing.T) (string, *countStore) {
+	setTestJWT(t, &JWTConf{Keys: []*jwt.Key{{ID: "k", Alg: jwt.HS256, Secret: "csrf-test"}}})
+	store := &countStore{MemoryStore: NewMemoryStore()}
+	setTestSession(t, &SessionConf{Name: "csrf_sid"}, store)
+	r := newTestRoute(func(ctx *Context) {
+		switch ctx.Request.URL.Query().Get("h") {
+		case "token":
+			ctx.JSON(ctx.CSRFToken())
+		case "signin":
+			ctx.SignIn(ctx.Request.URL.Query().Get("u"))
+			ctx.JSON(ctx.CSRFToken())
+		default:
+			ctx.JSON("ok")
+		}
+	}, CSRF(&CSRFConf{Secret: "s", Cookie: "csrf"}))
+	return serveRoute(t, r).URL + "/test", store
+}
+
+//csrfGet returns the token cookie and the cookies of the response
+func csrfGet(t *testing.T, url string, cookies ...*http.Cookie) (string, []*http.Cookie) {
+	req, _ := http.NewRequest("GET", url, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	var token string
+	for _, c := range res.Cookies() {
+		if c.Name == "csrf" {
+			token = c.Value
+		}
+	}
+	return token, res.Cookies()
+}
+
+func TestCSRF(t *testing.T) {
+	url, _ := csrfTestServer(t)
+	bearer, err := IssueToken(jwt.Claims{"sub": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anon, _ := csrfGet(t, url+"?h=token")
+	token1, cookies1 := csrfGet(t, url+"?h=signin&u=1")
+	_, cookies2 := csrfGet(t, url+"?h=signin&u=2")
+	session := func(cookies []*http.Cookie) *http.Cookie {
+		for _, c := range cookies {
+			if c.Name == "csrf_sid" {
+				return c
+			}
+		}
+		t.Fatal("no session cookie")
+		return nil
+	}
+	sid1, sid2 := session(cookies1), session(cookies2)
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		header  map[string]string
+		status  int
+	}{
+		{"no token", nil, nil, http.StatusForbidden},
+		{"anonymous token", []*http.Cookie{{Name: "csrf", Value: anon}}, map[string]string{"X-CSRF-Token": anon}, http.StatusOK},
+		{"cookie without header", []*http.Cookie{{Name: "csrf", Value: anon}}, nil, http.StatusForbidden},
+		{"header mismatch", []*http.Cookie{{Name: "csrf", Value: anon}}, map[string]string{"X-CSRF-Token": anon + "x"}, http.StatusForbidden},
+		{"forged token", []*http.Cookie{{Name: "csrf", Value: "a.b"}}, map[string]string{"X-CSRF-Token": "a.b"}, http.StatusForbidden},
+		{"junk authorization", []*http.Cookie{sid1}, map[string]string{"Authorization": "Bearer junk"}, http.StatusForbidden},
+		{"basic authorization", []*http.Cookie{sid1}, map[string]string{"Authorization": "Basic dTpw"}, http.StatusForbidden},
+		{"valid bearer", nil, map[string]string{"Authorization": "Bearer " + bearer}, http.StatusOK},
+		{"session token", []*http.Cookie{sid1, {Name: "csrf", Value: token1}}, map[string]string{"X-CSRF-Token": token1}, http.StatusOK},
+		{"token of another session", []*http.Cookie{sid2, {Name: "csrf", Value: token1}}, map[string]string{"X-CSRF-Token": token1}, http.StatusForbidden},
+		{"anonymous token with session", []*http.Cookie{sid1, {Name: "csrf", Value: anon}}, map[string]string{"X-CSRF-Token": anon}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", url, strings.NewReader(""))
+		for _, c := range tt.cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: status=%d,want %d", tt.name, res.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestCSRFForm(t *testing.T) {
+	u, _ := csrfTestServer(t)
+	token, _ := csrfGet(t, u+"?h=token")
+	var multi bytes.Buffer
+	mw := multipart.NewWriter(&multi)
+	mw.WriteField("_csrf", token)
+	mw.Close()
+	tests := []struct {
+		name, body, ctype, header string
+		status                    int
+	}{
+		{"urlencoded field", url.Values{"_csrf": {token}}.Encode(), "application/x-www-form-urlencoded; charset=utf-8", "", http.StatusOK},
+		{"multipart field", multi.String(), mw.FormDataContentType(), "", http.StatusForbidden},
+		{"multipart header", multi.String(), mw.FormDataContentType(), token, http.StatusOK},
+		{"query field", "", "", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", u+"?_csrf="+url.QueryEscape(token), strings.NewReader(tt.body))
+		req.AddCookie(&http.Cookie{Name: "csrf", Value: token})
+		if tt.ctype != "" {
+			req.Header.Set("Content-Type", tt.ctype)
+		}
+		if tt.header != "" {
+			req.Header.Set("X-CSRF-Token", tt.header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: status=%d,want %d", tt.name, res.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestCSRFLazy(t *testing.T) {
+	url, store := csrfTestServer(t)
+	_, cookies := csrfGet(t, url+"?h=signin&u=1")
+	loads := atomic.LoadInt32(&store.loads)
+	//a safe request without ctx.CSRFToken() doesn't touch the session or the token cookie
+	token, cookies2 := csrfGet(t, url, cookies...)
+	if token != "" || len(cookies2) != 0 || atomic.LoadInt32(&store.loads) != loads {
+		t.Fatalf("token=%q,cookies=%v,loads=%d->%d", token, cookies2, loads, store.loads)
+	}
+	//ctx.CSRFToken() keeps the valid token
+	if token, _ = csrfGet(t, url+"?h=token", cookies...); token != "" {
+		t.Fatal("the valid token is reissued")
+	}
+}
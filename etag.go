@@ -0,0 +1,129 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//AutoETag enable or disable the automatic weak ETag of the JSONResult responses,
+//default enabled,Say/SayStr may write the body in pieces so they aren't tagged,
+//use SayAll for a whole body or ETag for them
+func AutoETag(enable bool) {
+	app.DisableETag = !enable
+}
+
+//weakETag returns the weak ETag of data,W/"size-fnv64a"
+func weakETag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return `W/"` + strconv.FormatInt(int64(len(data)), 16) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+//fileETag returns the weak ETag of file,W/"size-modtime"
+func fileETag(fi os.FileInfo) string {
+	return `W/"` + strconv.FormatInt(fi.Size(), 16) + "-" + strconv.FormatInt(fi.ModTime().UnixNano(), 16) + `"`
+}
+
+//etagMatch weak comparison of If-None-Match and etag
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+//written returns true if the header of w has been written
+func written(w http.ResponseWriter) bool {
+	if ww, ok := w.(interface{ Written() bool }); ok {
+		return ww.Written()
+	}
+	return false
+}
+
+//conditional returns true if the request method supports conditional GET
+func (c *Context) conditional() bool {
+	return c.Request.Method == "GET" || c.Request.Method == "HEAD"
+}
+
+//write 输出完整的响应数据,GET/HEAD请求自动设置弱ETag并处理If-None-Match,
+//之前已有输出时不设置ETag
+//param:
+//	data 完整的响应数据
+func (c *Context) write(data []byte) {
+	if !app.DisableETag && c.conditional() && !written(c.ResponseWriter) {
+		h := c.ResponseWriter.Header()
+		etag := h.Get("ETag")
+		if etag == "" {
+			etag = weakETag(data)
+			h.Set("ETag", etag)
+		}
+		if etagMatch(c.Request.Header.Get("If-None-Match"), etag) {
+			c.NotModified()
+			return
+		}
+	}
+	c.ResponseWriter.Write(data)
+}
+
+//NotModified 输出304状态
+func (c *Context) NotModified() {
+	h := c.ResponseWriter.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	c.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+//ETag 设置ETag并检查If-None-Match,匹配则输出304并返回true
+//param:
+//	etag ETag值,如 "v1" 或 W/"v1"
+func (c *Context) ETag(etag string) bool {
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	c.ResponseWriter.Header().Set("ETag", etag)
+	if c.conditional() && etagMatch(c.Request.Header.Get("If-None-Match"), etag) {
+		c.NotModified()
+		return true
+	}
+	return false
+}
+
+//LastModified 设置Last-Modified并检查If-Modified-Since,未修改则输出304并返回true
+//param:
+//	t 最后修改时间
+func (c *Context) LastModified(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	t = t.UTC().Truncate(time.Second)
+	c.ResponseWriter.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+	if !c.conditional() || c.Request.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	ims := c.Request.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	if !t.After(since) {
+		c.NotModified()
+		return true
+	}
+	return false
+}
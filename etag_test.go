@@ -0,0 +1,94 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//getWithETag send a GET request with If-None-Match,returns the response and body
+func getWithETag(t *testing.T, url, inm string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if inm != "" {
+		req.Header.Set("If-None-Match", inm)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(data)
+}
+
+func TestAutoETag(t *testing.T) {
+	handlers := map[string]func(ctx *Context){
+		"json": func(ctx *Context) { ctx.JSONResult(map[string]int{"a": 1}) },
+		"say": func(ctx *Context) {
+			ctx.SayStr("part1,")
+			ctx.SayStr(ctx.GetString("v"))
+		},
+		"sayall": func(ctx *Context) { ctx.SayAll([]byte("all")) },
+		"mixed": func(ctx *Context) {
+			ctx.SayStr("[")
+			ctx.JSONResult(1)
+		},
+	}
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		handlers[ctx.GetString("h")](ctx)
+	}))
+	jsonRes, _ := getWithETag(t, srv.URL+"/test?h=json", "")
+	etag := jsonRes.Header.Get("ETag")
+	sayAllRes, _ := getWithETag(t, srv.URL+"/test?h=sayall", "")
+	sayAllETag := sayAllRes.Header.Get("ETag")
+	tests := []struct {
+		name, query, inm string
+		status           int
+		tagged           bool
+	}{
+		{"json", "h=json", "", http.StatusOK, true},
+		{"json not modified", "h=json", etag, http.StatusNotModified, true},
+		{"json stale etag", "h=json", `W/"x"`, http.StatusOK, true},
+		{"chunked say", "h=say&v=1", "", http.StatusOK, false},
+		{"chunked say with etag", "h=say&v=2", etag, http.StatusOK, false},
+		{"say all", "h=sayall", "", http.StatusOK, true},
+		{"say all not modified", "h=sayall", sayAllETag, http.StatusNotModified, true},
+		{"json after say", "h=mixed", "", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		res, _ := getWithETag(t, srv.URL+"/test?"+tt.query, tt.inm)
+		if res.StatusCode != tt.status || (res.Header.Get("ETag") != "") != tt.tagged {
+			t.Errorf("%s: status=%d,etag=%q", tt.name, res.StatusCode, res.Header.Get("ETag"))
+		}
+	}
+}
+
+func TestFileServerETag(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	srv := httptest.NewServer(NoLookDirHandler(http.StripPrefix("/static/", serveFile(http.Dir(root)))))
+	defer srv.Close()
+
+	res, body := getWithETag(t, srv.URL+"/static/a.txt", "")
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || body != "hello" || etag == "" {
+		t.Fatalf("status=%d,body=%q,etag=%q", res.StatusCode, body, etag)
+	}
+	if res, _ = getWithETag(t, srv.URL+"/static/a.txt", etag); res.StatusCode != http.StatusNotModified {
+		t.Errorf("matched etag: status=%d", res.StatusCode)
+	}
+	if res, _ = getWithETag(t, srv.URL+"/static/none.txt", ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: status=%d", res.StatusCode)
+	}
+	if res, _ = getWithETag(t, srv.URL+"/static/sub/", ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("directory: status=%d", res.StatusCode)
+	}
+}
@@ -51,9 +51,13 @@ func FileUpload(ctx *Context, dir string) {
 //FileHandleUpload 客户端上传多个文件,并带有请求参数
 func FileHandleUpload(ctx *Context, dir string, returnRealFile bool) ([]FileInfo, error) {
 	//ctx.ParseForm()
-	err := ctx.ParseMultipartForm(32 << 40) //最大内存为64M
+	err := ctx.ParseMultipartForm(32 << 20) //最大内存为32M,超出部分写入临时文件
 	if err != nil {
 		ctx.I("/files/upload-fileHandleUpload->parseMultipartForm-err=" + err.Error())
+		if isBodyTooLarge(err) {
+			ctx.bodyError(err)
+			return nil, errors.New("上传文件过大")
+		}
 		return nil, errors.New("上传格式不对")
 	}
 	mp := ctx.Request.MultipartForm
@@ -0,0 +1,90 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import "strings"
+
+//RouteGroup is a set of routes sharing a path prefix,middleware and required permissions
+type RouteGroup struct {
+	prefix      string
+	parent      *RouteGroup
+	middlewares []Middleware
+	permissions []string
+}
+
+//Group create the route group,the middleware is applied after the global middleware
+//	admin := bast.Group("/admin", bast.JWTAuth()).Require("admin")
+//	admin.Get("/users", listUsers).Require("users:read")
+func Group(prefix string, m ...Middleware) *RouteGroup {
+	return &RouteGroup{prefix: strings.TrimSuffix(prefix, "/"), middlewares: m}
+}
+
+//Group create the sub group,it inherits the middleware and permissions of g
+func (g *RouteGroup) Group(prefix string, m ...Middleware) *RouteGroup {
+	sub := Group(prefix, m...)
+	sub.parent = g
+	return sub
+}
+
+//Use registers the group middleware
+func (g *RouteGroup) Use(m ...Middleware) *RouteGroup {
+	g.middlewares = append(g.middlewares, m...)
+	return g
+}
+
+//Require add the permissions required by every route of the group
+func (g *RouteGroup) Require(permissions ...string) *RouteGroup {
+	g.permissions = append(g.permissions, permissions...)
+	return g
+}
+
+//Prefix returns the full path prefix of the group
+func (g *RouteGroup) Prefix() string {
+	if g.parent != nil {
+		return g.parent.Prefix() + g.prefix
+	}
+	return g.prefix
+}
+
+//Get registers the GET handler
+func (g *RouteGroup) Get(pattern string, f func(ctx *Context)) *Route {
+	return g.add(Get(g.Prefix()+pattern, f))
+}
+
+//Post registers the POST handler
+func (g *RouteGroup) Post(pattern string, f func(ctx *Context)) *Route {
+	return g.add(Post(g.Prefix()+pattern, f))
+}
+
+//FileServer serves files from the root directory,see FileServer
+func (g *RouteGroup) FileServer(pattern string, root string) *Route {
+	return g.add(FileServer(g.Prefix()+pattern, root))
+}
+
+//WebSocket registers the websocket handler,see WebSocket
+func (g *RouteGroup) WebSocket(pattern string, f func(ctx *Context, conn *WSConn), conf ...*WSConf) *Route {
+	return g.add(WebSocket(g.Prefix()+pattern, f, conf...))
+}
+
+func (g *RouteGroup) add(r *Route) *Route {
+	r.group = g
+	return r
+}
+
+//allMiddlewares returns the middleware of the group and its parents,outermost first
+func (g *RouteGroup) allMiddlewares() []Middleware {
+	if g.parent == nil {
+		return g.middlewares
+	}
+	ms := g.parent.allMiddlewares()
+	return append(ms[:len(ms):len(ms)], g.middlewares...)
+}
+
+//allPermissions returns the permissions of the group and its parents
+func (g *RouteGroup) allPermissions() []string {
+	if g.parent == nil {
+		return g.permissions
+	}
+	ps := g.parent.allPermissions()
+	return append(ps[:len(ps):len(ps)], g.permissions...)
+}
@@ -3,6 +3,8 @@ package bast
 import (
 	"crypto/tls"
 	"net/http"
+
+	"github.com/aixiaoxiang/bast/logs"
 )
 
 var (
@@ -21,8 +23,12 @@ type HTTPClientProxy struct {
 	// http.Client
 }
 
-//Dos when http call HTTPClient.Do or https call HTTPSClient.Do
+//Dos when http call HTTPClient.Do or https call HTTPSClient.Do,
+//the request id of req.Context() is forwarded as X-Request-ID
 func (c *HTTPClientProxy) Dos(req *http.Request) (*http.Response, error) {
+	if id := logs.RequestID(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
 	if req.URL.Scheme == "https" {
 		return HTTPSClient.Do(req)
 	}
@@ -0,0 +1,112 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//IPFilterConf ip allow/deny list,a plain ip is a single host
+type IPFilterConf struct {
+	//Allow allowed CIDRs,empty allows any ip not denied
+	Allow []string `json:"allow"`
+	//Deny denied CIDRs,checked before Allow
+	Deny []string `json:"deny"`
+}
+
+//ipRules the parsed CIDRs of a config
+type ipRules struct {
+	conf        *IPFilterConf
+	allow, deny []*net.IPNet
+	invalid     bool
+}
+
+//ipFilter checks the client ip,the rules are parsed again when the config changes
+type ipFilter struct {
+	name  string
+	conf  func() *IPFilterConf
+	rules atomic.Value
+}
+
+//IPFilter returns the middleware checking Context.ClientIP against the lists,
+//it replies SerIPDenied with 403 if the ip is denied
+//	admin := bast.Group("/admin", bast.IPFilter(&bast.IPFilterConf{Allow: []string{"10.8.0.0/16"}}))
+func IPFilter(conf *IPFilterConf) Middleware {
+	f := &ipFilter{conf: func() *IPFilterConf { return conf }}
+	return f.handle
+}
+
+//IPFilterPolicy returns the ip filter middleware of the named item of AppConf.IPFilters,
+//the item is read on every request so config reloads apply,
+//the request is denied and an error is logged if the item doesn't exist,so a typo never opens the routes
+//	admin := bast.Group("/admin", bast.IPFilterPolicy("office"))
+func IPFilterPolicy(name string) Middleware {
+	f := &ipFilter{name: name, conf: func() *IPFilterConf {
+		if c := Conf(); c != nil {
+			return c.IPFilters[name]
+		}
+		return nil
+	}}
+	return f.handle
+}
+
+func (f *ipFilter) handle(ctx *Context, next func(ctx *Context)) {
+	conf := f.conf()
+	pattern := ""
+	if r := ctx.Route(); r != nil {
+		pattern = r.Pattern
+	}
+	ip := ctx.ClientIP()
+	switch {
+	case conf == nil && f.name == "":
+		next(ctx)
+		return
+	case conf == nil:
+		//fail closed,a typo or a policy removed by a reload must not open the routes
+		logs.Error("ip filter policy " + f.name + " not found,ip=" + ip + ",pattern=" + pattern + ",uri=" + ctx.Request.RequestURI)
+	case f.load(conf).allowed(net.ParseIP(ip)):
+		next(ctx)
+		return
+	default:
+		logs.Info("ip denied,ip=" + ip + ",pattern=" + pattern + ",policy=" + f.name + ",uri=" + ctx.Request.RequestURI)
+	}
+	ctx.FailResultWithStatus(http.StatusForbidden, "IP禁止访问", SerIPDenied)
+}
+
+//load returns the rules of conf,parse them if the config has changed
+func (f *ipFilter) load(conf *IPFilterConf) *ipRules {
+	if r, ok := f.rules.Load().(*ipRules); ok && r.conf == conf {
+		return r
+	}
+	r := &ipRules{conf: conf}
+	var err error
+	if r.allow, err = parseCIDRs(conf.Allow); err == nil {
+		r.deny, err = parseCIDRs(conf.Deny)
+	}
+	if err != nil {
+		//fail closed,a broken list must not open the routes
+		r.invalid = true
+		logs.Error("ip filter " + f.name + " config error=" + err.Error())
+	}
+	f.rules.Store(r)
+	return r
+}
+
+//allowed returns true if ip passes the lists
+func (r *ipRules) allowed(ip net.IP) bool {
+	if r.invalid {
+		return false
+	}
+	if ip == nil {
+		//an unknown client passes only if there are no rules
+		return len(r.allow) == 0 && len(r.deny) == 0
+	}
+	if containsIP(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || containsIP(r.allow, ip)
+}
@@ -0,0 +1,55 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	setTestConf(t, &AppConf{Key: "ipfilter", IPFilters: map[string]*IPFilterConf{
+		"office": {Allow: []string{"10.0.0.0/8"}},
+		"block":  {Deny: []string{"1.2.3.4"}},
+		"broken": {Allow: []string{"10.0.0.0/99"}},
+	}})
+	//the test client is a trusted loopback proxy
+	setTestProxies(t, defaultTrustedProxies...)
+	srv := setTestRouter(t)
+	ok := func(ctx *Context) { ctx.JSON("ok") }
+	Get("/ipfilter-test/office", ok).Use(IPFilterPolicy("office"))
+	Get("/ipfilter-test/block", ok).Use(IPFilterPolicy("block"))
+	Get("/ipfilter-test/broken", ok).Use(IPFilterPolicy("broken"))
+	Get("/ipfilter-test/typo", ok).Use(IPFilterPolicy("ofice"))
+	Get("/ipfilter-test/none", ok).Use(IPFilter(nil))
+	Get("/ipfilter-test/static", ok).Use(IPFilter(&IPFilterConf{Allow: []string{"192.168.0.0/16"}, Deny: []string{"192.168.1.0/24"}}))
+
+	tests := []struct {
+		path, ip string
+		status   int
+	}{
+		{"/ipfilter-test/office", "10.1.2.3", http.StatusOK},
+		{"/ipfilter-test/office", "192.168.1.1", http.StatusForbidden},
+		{"/ipfilter-test/office", "not-an-ip", http.StatusForbidden},
+		{"/ipfilter-test/block", "5.6.7.8", http.StatusOK},
+		{"/ipfilter-test/block", "1.2.3.4", http.StatusForbidden},
+		{"/ipfilter-test/block", "not-an-ip", http.StatusForbidden},
+		{"/ipfilter-test/broken", "10.1.2.3", http.StatusForbidden},
+		{"/ipfilter-test/typo", "10.1.2.3", http.StatusForbidden},
+		{"/ipfilter-test/none", "not-an-ip", http.StatusOK},
+		{"/ipfilter-test/static", "192.168.2.1", http.StatusOK},
+		{"/ipfilter-test/static", "192.168.1.1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+		req.Header.Set("X-Real-IP", tt.ip)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("%s ip=%s: status=%d,want %d", tt.path, tt.ip, res.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aixiaoxiang/bast/jwt"
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+const (
+	//ClaimsKey the request store key of the verified JWT claims
+	ClaimsKey = "bast.claims"
+	//UserKey the request store key of the authenticated user,JWTAuth sets it to the sub claim
+	UserKey = "bast.user"
+)
+
+//ErrNoToken the request doesn't carry a token
+var ErrNoToken = errors.New("jwt: no token")
+
+//JWTConf JWT config,all keys are accepted for verification,
+//so a new key can be added before it becomes the active key and the old one removed after its tokens expire
+type JWTConf struct {
+	//Keys verification keys
+	Keys []*jwt.Key `json:"keys"`
+	//ActiveKey the key id used by IssueToken,default the first key that can sign
+	ActiveKey string `json:"activeKey"`
+	//Issuer the iss claim of issued tokens and the expected iss,empty skips the check
+	Issuer string `json:"issuer"`
+	//Audience the aud claim of issued tokens and the accepted aud,empty skips the check
+	Audience []string `json:"audience"`
+	//TTL lifetime(seconds) of issued tokens,default 7200
+	TTL int `json:"ttl"`
+	//Skew allowed clock skew(seconds) of exp and nbf,default 60
+	Skew int `json:"skew"`
+	//AllowNoExp accept the tokens without exp,default they are rejected
+	AllowNoExp bool `json:"allowNoExp"`
+	//Cookie also read the token from the cookie if the Authorization header is absent
+	Cookie string `json:"cookie"`
+	//Query also read the token from the query parameter,for websocket and EventSource clients
+	Query string `json:"query"`
+}
+
+//JWTInit set the JWT config and parse the keys,
+//it's called with AppConf.JWT when the app runs
+func JWTInit(conf *JWTConf) error {
+	if conf == nil {
+		return errors.New("jwt: nil config")
+	}
+	if len(conf.Keys) == 0 {
+		return errors.New("jwt: no keys")
+	}
+	for _, k := range conf.Keys {
+		if k == nil {
+			continue
+		}
+		if err := k.Init(); err != nil {
+			return err
+		}
+	}
+	app.jwtMu.Lock()
+	app.jwtConf = conf
+	app.jwtMu.Unlock()
+	return nil
+}
+
+//jwtConfig returns the JWT config,loads AppConf.JWT on first use
+func jwtConfig() (*JWTConf, error) {
+	app.jwtMu.RLock()
+	conf := app.jwtConf
+	app.jwtMu.RUnlock()
+	if conf != nil {
+		return conf, nil
+	}
+	if c := Conf(); c != nil && c.JWT != nil {
+		if err := JWTInit(c.JWT); err != nil {
+			return nil, err
+		}
+		return c.JWT, nil
+	}
+	return nil, errors.New("jwt: not configured")
+}
+
+//IssueToken sign the claims with the active key,
+//iat,exp,iss and aud are filled from the config if absent
+func IssueToken(claims jwt.Claims) (string, error) {
+	conf, err := jwtConfig()
+	if err != nil {
+		return "", err
+	}
+	var key *jwt.Key
+	for _, k := range conf.Keys {
+		if k == nil || (conf.ActiveKey != "" && k.ID != conf.ActiveKey) {
+			continue
+		}
+		if k.Alg == jwt.HS256 || k.PrivateKey != "" {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return "", errors.New("jwt: no active signing key")
+	}
+	c := make(jwt.Claims, len(claims)+4)
+	for k, v := range claims {
+		c[k] = v
+	}
+	now := time.Now()
+	if _, ok := c["iat"]; !ok {
+		c["iat"] = now.Unix()
+	}
+	if _, ok := c["exp"]; !ok {
+		ttl := conf.TTL
+		if ttl <= 0 {
+			ttl = 7200
+		}
+		c["exp"] = now.Add(time.Duration(ttl) * time.Second).Unix()
+	}
+	if _, ok := c["iss"]; !ok && conf.Issuer != "" {
+		c["iss"] = conf.Issuer
+	}
+	if _, ok := c["aud"]; !ok && len(conf.Audience) > 0 {
+		if len(conf.Audience) == 1 {
+			c["aud"] = conf.Audience[0]
+		} else {
+			c["aud"] = conf.Audience
+		}
+	}
+	return jwt.Sign(c, key)
+}
+
+//ParseToken verify the token and validate the claims
+func ParseToken(token string) (jwt.Claims, error) {
+	conf, err := jwtConfig()
+	if err != nil {
+		return nil, err
+	}
+	skew := conf.Skew
+	if skew <= 0 {
+		skew = 60
+	}
+	return jwt.Parse(token, conf.Keys, &jwt.Options{
+		Issuer:     conf.Issuer,
+		Audience:   conf.Audience,
+		Skew:       time.Duration(skew) * time.Second,
+		AllowNoExp: conf.AllowNoExp,
+	})
+}
+
+//JWTAuth returns the middleware verifying the bearer token,
+//the claims are put in the request store(see Context.Claims),
+//it replies SerInvalidUserAuthorize with 401 if the token is absent or invalid
+//	bast.Get("/profile", profile).Use(bast.JWTAuth())
+func JWTAuth() Middleware {
+	return func(ctx *Context, next func(ctx *Context)) {
+		conf, err := jwtConfig()
+		if err == nil {
+			var claims jwt.Claims
+			token := bearerToken(ctx, conf)
+			if token == "" {
+				err = ErrNoToken
+			} else if claims, err = ParseToken(token); err == nil {
+				ctx.Set(ClaimsKey, claims)
+				if sub := claims.Subject(); sub != "" {
+					ctx.Set(UserKey, sub)
+				}
+				next(ctx)
+				return
+			}
+		}
+		logs.Debug("jwt auth failed,uri=" + ctx.Request.RequestURI + ",error=" + err.Error())
+		ctx.ResponseWriter.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		ctx.FailResultWithStatus(http.StatusUnauthorized, "用户认证失败,详情："+err.Error(), SerInvalidUserAuthorize)
+	}
+}
+
+//bearerToken returns the token of the request
+func bearerToken(ctx *Context, conf *JWTConf) string {
+	if auth := ctx.Request.Header.Get("Authorization"); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return ""
+	}
+	if conf.Cookie != "" {
+		if c, err := ctx.Request.Cookie(conf.Cookie); err == nil {
+			return c.Value
+		}
+	}
+	if conf.Query != "" {
+		return ctx.Request.URL.Query().Get(conf.Query)
+	}
+	return ""
+}
+
+//Claims 获取当前请求已验证的JWT声明,未认证返回nil
+func (c *Context) Claims() jwt.Claims {
+	if v, ok := c.Get(ClaimsKey); ok {
+		claims, _ := v.(jwt.Claims)
+		return claims
+	}
+	return nil
+}
+
+//User 获取当前请求的认证用户(JWTAuth为sub声明),
+//未认证时返回已加载会话中的登录用户,都没有返回nil
+func (c *Context) User() interface{} {
+	if v, ok := c.Get(UserKey); ok {
+		return v
+	}
+	if v, ok := c.Get(sessionCtxKey); ok {
+		return v.(*Session).Get(SessionUserKey)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+//Package jwt provides a small JSON Web Token implementation,
+//supports HS256,RS256 and ES256 with key ids for key rotation
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+//errors
+var (
+	ErrInvalidToken     = errors.New("jwt: invalid token")
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	ErrUnknownKey       = errors.New("jwt: unknown key")
+	ErrExpired          = errors.New("jwt: token is expired")
+	ErrNoExpiration     = errors.New("jwt: token has no expiration")
+	ErrNotValidYet      = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer    = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience  = errors.New("jwt: invalid audience")
+	ErrUnsupportedAlg   = errors.New("jwt: unsupported algorithm")
+)
+
+//Claims token claims
+type Claims map[string]interface{}
+
+//String returns the string claim
+func (c Claims) String(key string) string {
+	s, _ := c[key].(string)
+	return s
+}
+
+//Int64 returns the numeric claim
+func (c Claims) Int64(key string) (int64, bool) {
+	switch v := c[key].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+//Strings returns the string array claim,a single string is returned as an array
+func (c Claims) Strings(key string) []string {
+	switch v := c[key].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				ss = append(ss, str)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+//Subject returns the sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+//Key signing key
+type Key struct {
+	//ID key id(kid)
+	ID string `json:"id"`
+	//Alg HS256|RS256|ES256
+	Alg string `json:"alg"`
+	//Secret HS256 secret
+	Secret string `json:"secret"`
+	//PrivateKey RS256/ES256 private key,PEM content or file path,only needed for signing
+	PrivateKey string `json:"privateKey"`
+	//PublicKey RS256/ES256 public key,PEM content or file path
+	PublicKey  string `json:"publicKey"`
+	signKey    interface{}
+	verifyKey  interface{}
+	initialize bool
+}
+
+//Init parse the key material,it is called by Sign and Parse,
+//call it before the key is shared by goroutines
+func (k *Key) Init() error {
+	if k.initialize {
+		return nil
+	}
+	switch k.Alg {
+	case HS256:
+		if k.Secret == "" {
+			return errors.New("jwt: empty secret of key " + k.ID)
+		}
+		k.signKey = []byte(k.Secret)
+		k.verifyKey = k.signKey
+	case RS256, ES256:
+		if k.PrivateKey != "" {
+			block, err := pemBlock(k.PrivateKey)
+			if err != nil {
+				return err
+			}
+			priv, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			k.signKey = priv
+			switch p := priv.(type) {
+			case *rsa.PrivateKey:
+				k.verifyKey = &p.PublicKey
+			case *ecdsa.PrivateKey:
+				k.verifyKey = &p.PublicKey
+			}
+		}
+		if k.PublicKey != "" {
+			block, err := pemBlock(k.PublicKey)
+			if err != nil {
+				return err
+			}
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				if cert, cerr := x509.ParseCertificate(block.Bytes); cerr == nil {
+					pub, err = cert.PublicKey, nil
+				} else if rpub, rerr := x509.ParsePKCS1PublicKey(block.Bytes); rerr == nil {
+					pub, err = rpub, nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+			k.verifyKey = pub
+		}
+		if k.verifyKey == nil {
+			return errors.New("jwt: no key material of key " + k.ID)
+		}
+		if _, ok := k.verifyKey.(*rsa.PublicKey); ok != (k.Alg == RS256) {
+			return errors.New("jwt: key type doesn't match the algorithm of key " + k.ID)
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	k.initialize = true
+	return nil
+}
+
+//pemBlock decode the PEM content or file
+func pemBlock(s string) (*pem.Block, error) {
+	data := []byte(s)
+	if !strings.Contains(s, "-----BEGIN") {
+		var err error
+		data, err = ioutil.ReadFile(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: invalid PEM")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("jwt: invalid private key")
+	}
+	return k, nil
+}
+
+//Sign returns the signed token of claims
+func Sign(claims Claims, key *Key) (string, error) {
+	if err := key.Init(); err != nil {
+		return "", err
+	}
+	if key.signKey == nil {
+		return "", errors.New("jwt: no private key of key " + key.ID)
+	}
+	header := map[string]string{"alg": key.Alg, "typ": "JWT"}
+	if key.ID != "" {
+		header["kid"] = key.ID
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := encode(h) + "." + encode(c)
+	sig, err := sign(signing, key)
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + encode(sig), nil
+}
+
+func sign(signing string, key *Key) ([]byte, error) {
+	switch key.Alg {
+	case HS256:
+		m := hmac.New(sha256.New, key.signKey.([]byte))
+		m.Write([]byte(signing))
+		return m.Sum(nil), nil
+	case RS256:
+		pk, ok := key.signKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedAlg
+		}
+		d := sha256.Sum256([]byte(signing))
+		return rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, d[:])
+	case ES256:
+		pk, ok := key.signKey.(*ecdsa.PrivateKey)
+		if !ok || pk.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedAlg
+		}
+		d := sha256.Sum256([]byte(signing))
+		r, s, err := ecdsa.Sign(rand.Reader, pk, d[:])
+		if err != nil {
+			return nil, err
+		}
+		//JWS uses the fixed size r||s,not ASN.1
+		sig := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+		return sig, nil
+	}
+	return nil, ErrUnsupportedAlg
+}
+
+func verify(signing string, sig []byte, key *Key) bool {
+	switch key.Alg {
+	case HS256:
+		m := hmac.New(sha256.New, key.verifyKey.([]byte))
+		m.Write([]byte(signing))
+		return hmac.Equal(sig, m.Sum(nil))
+	case RS256:
+		pk, ok := key.verifyKey.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		d := sha256.Sum256([]byte(signing))
+		return rsa.VerifyPKCS1v15(pk, crypto.SHA256, d[:], sig) == nil
+	case ES256:
+		pk, ok := key.verifyKey.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		d := sha256.Sum256([]byte(signing))
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pk, d[:], r, s)
+	}
+	return false
+}
+
+//Options validation options
+type Options struct {
+	//Issuer expected iss,empty skips the check
+	Issuer string
+	//Audience accepted aud,empty skips the check
+	Audience []string
+	//Skew allowed clock skew of exp and nbf
+	Skew time.Duration
+	//AllowNoExp accept the tokens without exp,they never expire
+	AllowNoExp bool
+	//Now returns the current time,default time.Now
+	Now func() time.Time
+}
+
+//Parse verify the token with keys and validate the claims,
+//the key is selected by kid,all keys of the algorithm are tried if kid is empty
+func Parse(token string, keys []*Key, opts *Options) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	h, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(h, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signing := parts[0] + "." + parts[1]
+	found, verified := false, false
+	for _, k := range keys {
+		if k == nil || k.Alg != header.Alg || (header.Kid != "" && k.ID != header.Kid) {
+			continue
+		}
+		if err := k.Init(); err != nil {
+			continue
+		}
+		found = true
+		if verify(signing, sig, k) {
+			verified = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+	c, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := Claims{}
+	if err := json.Unmarshal(c, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := Validate(claims, opts); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+//Validate validate exp,nbf,iss and aud,
+//the tokens without exp are rejected unless opts.AllowNoExp
+func Validate(claims Claims, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+	unix := now.Unix()
+	skew := int64(opts.Skew / time.Second)
+	if exp, ok := claims.Int64("exp"); !ok {
+		if !opts.AllowNoExp {
+			return ErrNoExpiration
+		}
+	} else if unix > exp+skew {
+		return ErrExpired
+	}
+	if nbf, ok := claims.Int64("nbf"); ok && unix < nbf-skew {
+		return ErrNotValidYet
+	}
+	if opts.Issuer != "" && claims.String("iss") != opts.Issuer {
+		return ErrInvalidIssuer
+	}
+	if len(opts.Audience) > 0 {
+		ok := false
+		for _, a := range claims.Strings("aud") {
+			for _, b := range opts.Audience {
+				if a == b {
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			return ErrInvalidAudience
+		}
+	}
+	return nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,79 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func pemKey(t *testing.T, typ string, der []byte, err error) string {
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+func TestSignParse(t *testing.T) {
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDer, err := x509.MarshalECPrivateKey(ek)
+	ecPub, perr := x509.MarshalPKIXPublicKey(&ek.PublicKey)
+	keys := []*Key{
+		{ID: "h1", Alg: HS256, Secret: "secret"},
+		{ID: "r1", Alg: RS256, PrivateKey: pemKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rk), nil)},
+		{ID: "e1", Alg: ES256, PrivateKey: pemKey(t, "EC PRIVATE KEY", ecDer, err)},
+	}
+	//verification only key
+	verifyKeys := append([]*Key{{ID: "e1", Alg: ES256, PublicKey: pemKey(t, "PUBLIC KEY", ecPub, perr)}}, keys[:2]...)
+	opts := &Options{Issuer: "bast", Audience: []string{"api"}, Skew: time.Minute}
+	for _, k := range keys {
+		token, err := Sign(Claims{"sub": "1", "iss": "bast", "aud": []string{"web", "api"}, "exp": time.Now().Add(time.Hour).Unix()}, k)
+		if err != nil {
+			t.Fatal(k.Alg, err)
+		}
+		c, err := Parse(token, verifyKeys, opts)
+		if err != nil || c.Subject() != "1" {
+			t.Fatal(k.Alg, err)
+		}
+		if _, err := Parse(token[:len(token)-2]+"xx", verifyKeys, opts); err != ErrInvalidSignature {
+			t.Fatal(k.Alg, "tampered token", err)
+		}
+	}
+	if _, err := Parse(mustSign(t, Claims{"iss": "bast", "aud": "api"}, &Key{ID: "h2", Alg: HS256, Secret: "secret"}), keys, opts); err != ErrUnknownKey {
+		t.Fatal("unknown kid", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	cases := []struct {
+		claims     Claims
+		allowNoExp bool
+		err        error
+	}{
+		{Claims{"iss": "bast", "aud": "api", "exp": time.Now().Add(-2 * time.Minute).Unix()}, false, ErrExpired},
+		{Claims{"iss": "bast", "aud": "api", "exp": time.Now().Add(-30 * time.Second).Unix()}, false, nil},
+		{Claims{"iss": "bast", "aud": "api", "exp": exp, "nbf": time.Now().Add(2 * time.Minute).Unix()}, false, ErrNotValidYet},
+		{Claims{"iss": "other", "aud": "api", "exp": exp}, false, ErrInvalidIssuer},
+		{Claims{"iss": "bast", "aud": "web", "exp": exp}, false, ErrInvalidAudience},
+		{Claims{"iss": "bast", "aud": "api"}, false, ErrNoExpiration},
+		{Claims{"iss": "bast", "aud": "api"}, true, nil},
+	}
+	for i, c := range cases {
+		o := *opts
+		o.AllowNoExp = c.allowNoExp
+		if _, err := Parse(mustSign(t, c.claims, keys[0]), keys, &o); err != c.err {
+			t.Fatal(i, err)
+		}
+	}
+}
+
+func mustSign(t *testing.T, c Claims, k *Key) string {
+	token, err := Sign(c, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
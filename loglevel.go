@@ -0,0 +1,45 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+func init() {
+	onControl("level", func(args map[string]string) (string, error) {
+		revert, _ := strconv.Atoi(args["revert"])
+		if err := logs.SetLevel(args["level"], time.Duration(revert)*time.Second); err != nil {
+			return "", err
+		}
+		return "level=" + logs.Level(), nil
+	})
+}
+
+//logLevelResult the reply of the log level route
+type logLevelResult struct {
+	Level  string `json:"level"`
+	Revert int    `json:"revert"`
+}
+
+//LogLevelRoute registers the POST route changing the log level of this process,
+//params: level(debug|info|warn|error,empty returns the current level),revert(seconds,0 means never),
+//protect it with authorization
+//	bast.LogLevelRoute("/admin/log/level").Use(bast.JWTAuth()).Require("admin")
+func LogLevelRoute(pattern string) *Route {
+	return Post(pattern, func(ctx *Context) {
+		level := ctx.GetTrimString("level")
+		revert := ctx.GetIntVal("revert")
+		if level != "" {
+			if err := logs.SetLevel(level, time.Duration(revert)*time.Second); err != nil {
+				ctx.FailResult("日志级别错误", SerInvalidParamError, err)
+				return
+			}
+			logs.Info("log level changed to " + logs.Level() + ",revert=" + strconv.Itoa(revert) + "s")
+		}
+		ctx.JSON(&logLevelResult{Level: logs.Level(), Revert: revert})
+	})
+}
@@ -0,0 +1,87 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//setTestLevel init the logger at info level,it's cleared after the test
+func setTestLevel(t *testing.T) {
+	setTestLog(t, &logs.LogConf{Outputs: []*logs.OutputConf{{Type: "stdout"}}, Level: "info"})
+}
+
+func TestLogLevelRoute(t *testing.T) {
+	setTestLevel(t)
+	srv := setTestRouter(t)
+	LogLevelRoute("/log/level")
+	tests := []struct {
+		name, level, revert string
+		code                int
+		want                string
+	}{
+		{"current", "", "", SerOK, "info"},
+		{"set", "debug", "", SerOK, "debug"},
+		{"invalid", "verbose", "", SerInvalidParamError, "debug"},
+		{"revert", "warn", "1", SerOK, "warn"},
+	}
+	for _, tt := range tests {
+		res, err := http.PostForm(srv.URL+"/log/level", url.Values{"level": {tt.level}, "revert": {tt.revert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &struct {
+			Code int            `json:"code"`
+			Data logLevelResult `json:"data"`
+		}{}
+		json.NewDecoder(res.Body).Decode(result)
+		res.Body.Close()
+		if result.Code != tt.code || logs.Level() != tt.want {
+			t.Errorf("%s: code=%d level=%s,want %d %s", tt.name, result.Code, logs.Level(), tt.code, tt.want)
+		}
+		if tt.code == SerOK && result.Data.Level != tt.want {
+			t.Errorf("%s: reply level=%s", tt.name, result.Data.Level)
+		}
+	}
+	time.Sleep(1200 * time.Millisecond)
+	if logs.Level() != "info" {
+		t.Fatal("not reverted:", logs.Level())
+	}
+}
+
+func TestLogLevelControl(t *testing.T) {
+	setTestLevel(t)
+	startTestControl(t)
+	tests := []struct {
+		args map[string]string
+		ok   bool
+		want string
+	}{
+		{map[string]string{"level": "debug"}, true, "debug"},
+		{map[string]string{"level": "verbose"}, false, "debug"},
+		{map[string]string{"level": "error", "revert": "1"}, true, "error"},
+	}
+	for _, tt := range tests {
+		reply, err := sendControl(os.Getpid(), &controlMsg{Cmd: "level", Args: tt.args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.OK != tt.ok || logs.Level() != tt.want {
+			t.Errorf("%v: reply=%+v level=%s", tt.args, reply, logs.Level())
+		}
+		if tt.ok && reply.Msg != "level="+tt.want {
+			t.Errorf("%v: reply=%+v", tt.args, reply)
+		}
+	}
+	time.Sleep(1200 * time.Millisecond)
+	if logs.Level() != "info" {
+		t.Fatal("not reverted:", logs.Level())
+	}
+}
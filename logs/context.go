@@ -0,0 +1,32 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+//ctxKey context key type
+type ctxKey string
+
+//RequestIDKey the context key of the request id
+const RequestIDKey ctxKey = "requestId"
+
+//RequestID returns the request id of ctx,empty if not exist
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+//WithRequestID returns the fields with the request id of ctx
+func WithRequestID(ctx context.Context, fields ...zap.Field) []zap.Field {
+	if id := RequestID(ctx); id != "" {
+		return append(fields, zap.String("requestId", id))
+	}
+	return fields
+}
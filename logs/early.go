@@ -0,0 +1,97 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+//maxEarlyEntries max entries buffered before LogInit,the later ones are counted and dropped
+const maxEarlyEntries = 1000
+
+//early the entries logged before LogInit(or after ClearLogger)
+var early = &earlyBuffer{}
+
+type earlyEntry struct {
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}
+
+type earlyBuffer struct {
+	mu      sync.Mutex
+	entries []earlyEntry
+	dropped int
+}
+
+//add buffer the entry
+func (b *earlyBuffer) add(ent zapcore.Entry, fields []zapcore.Field) {
+	b.mu.Lock()
+	if len(b.entries) < maxEarlyEntries {
+		b.entries = append(b.entries, earlyEntry{ent: ent, fields: fields})
+	} else {
+		b.dropped++
+	}
+	b.mu.Unlock()
+}
+
+//flush write the buffered entries to core,the core filters them by its level
+func (b *earlyBuffer) flush(core zapcore.Core) {
+	b.mu.Lock()
+	entries, dropped := b.entries, b.dropped
+	b.entries, b.dropped = nil, 0
+	b.mu.Unlock()
+	for _, e := range entries {
+		if ce := core.Check(e.ent, nil); ce != nil {
+			ce.Write(e.fields...)
+		}
+	}
+	if dropped > 0 {
+		ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Now(), Message: strconv.Itoa(dropped) + " log entries before init were dropped"}
+		if ce := core.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+}
+
+//earlyCore buffers the entries until the logger is created
+type earlyCore struct {
+	buf    *earlyBuffer
+	fields []zapcore.Field
+}
+
+//newEarlyLogger create the logger used before LogInit
+func newEarlyLogger() *XLogger {
+	return &XLogger{Logger: *zap.New(&earlyCore{buf: early})}
+}
+
+func (c *earlyCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *earlyCore) With(fields []zapcore.Field) zapcore.Core {
+	fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	fs = append(fs, c.fields...)
+	return &earlyCore{buf: c.buf, fields: append(fs, fields...)}
+}
+
+func (c *earlyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *earlyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if len(c.fields) > 0 {
+		fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+		fields = append(append(fs, c.fields...), fields...)
+	}
+	c.buf.add(ent, fields)
+	return nil
+}
+
+func (c *earlyCore) Sync() error {
+	return nil
+}
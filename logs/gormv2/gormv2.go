@@ -0,0 +1,153 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+//Package gormv2 the gorm v2 logger writing to the bast logs
+package gormv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+//Logger gorm v2 logger.Interface,the statements are logged with logs.LogSQL,
+//use it as a plugin too,so the args are passed to logs.LogSQL apart from the statement
+//and the args of the sensitive columns are masked(see logs.RedactConf)
+//	l := gormv2.New()
+//	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: l})
+//	db.Use(l)
+type Logger struct {
+	//SlowThreshold overrides logs.SQLLogConf.SlowThreshold if not 0
+	SlowThreshold time.Duration
+	//IgnoreRecordNotFoundError don't log gorm.ErrRecordNotFound as an error
+	IgnoreRecordNotFoundError bool
+	level                     logger.LogLevel
+}
+
+//New create the logger with the Info level,all statements are logged
+func New() *Logger {
+	return &Logger{level: logger.Info, IgnoreRecordNotFoundError: true}
+}
+
+//statementKey the context key of the captured statement
+type statementKey struct{}
+
+//statement the statement and the args of the last executed callback,
+//gorm passes the interpolated sql to Trace only
+type statement struct {
+	sql  string
+	vars []interface{}
+}
+
+//Name see gorm.Plugin
+func (l *Logger) Name() string {
+	return "bast:gormv2"
+}
+
+//Initialize see gorm.Plugin,capture the statement after the other callbacks
+func (l *Logger) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Register("bast:gormv2", captureStatement),
+		cb.Query().Register("bast:gormv2", captureStatement),
+		cb.Update().Register("bast:gormv2", captureStatement),
+		cb.Delete().Register("bast:gormv2", captureStatement),
+		cb.Row().Register("bast:gormv2", captureStatement),
+		cb.Raw().Register("bast:gormv2", captureStatement),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//captureStatement keep the statement in the context for Trace,
+//it runs just before Trace in the same goroutine
+func captureStatement(db *gorm.DB) {
+	stmt := db.Statement
+	if stmt == nil || stmt.SQL.Len() == 0 {
+		return
+	}
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s, ok := ctx.Value(statementKey{}).(*statement); ok {
+		s.sql, s.vars = stmt.SQL.String(), stmt.Vars
+		return
+	}
+	stmt.Context = context.WithValue(ctx, statementKey{}, &statement{sql: stmt.SQL.String(), vars: stmt.Vars})
+}
+
+//LogMode returns a copy with the level
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *l
+	c.level = level
+	return &c
+}
+
+//Info log the message at info level
+func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		logs.InfoWithCaller(fmt.Sprintf(msg, data...), utils.FileWithLineNum(), logs.WithRequestID(ctx)...)
+	}
+}
+
+//Warn log the message at warn level
+func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		logs.WarnWithCaller(fmt.Sprintf(msg, data...), utils.FileWithLineNum(), logs.WithRequestID(ctx)...)
+	}
+}
+
+//Error log the message at error level
+func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		logs.ErrorWithCaller(fmt.Sprintf(msg, data...), utils.FileWithLineNum(), logs.WithRequestID(ctx)...)
+	}
+}
+
+//Trace log the statement,Error level logs the failed ones,Warn adds the slow ones and Info logs all
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	var stmt statement
+	if ctx != nil {
+		if s, ok := ctx.Value(statementKey{}).(*statement); ok {
+			//consume it,the next Trace may come without a captured statement
+			stmt = *s
+			s.sql, s.vars = "", nil
+		}
+	}
+	if l.level <= logger.Silent {
+		return
+	}
+	if err != nil && l.IgnoreRecordNotFoundError && errors.Is(err, logger.ErrRecordNotFound) {
+		err = nil
+	}
+	elapsed := time.Since(begin)
+	threshold := l.SlowThreshold
+	if threshold == 0 {
+		if conf := logs.SQLConf(); conf != nil {
+			threshold = time.Duration(conf.SlowThreshold) * time.Millisecond
+		}
+	}
+	slow := threshold > 0 && elapsed > threshold
+	switch {
+	case err != nil:
+	case slow && l.level >= logger.Warn:
+	case l.level >= logger.Info:
+	default:
+		return
+	}
+	sql, rows := fc()
+	if stmt.sql != "" {
+		//the args are redacted by column before they are formatted
+		sql = stmt.sql
+	}
+	logs.LogSQL(ctx, &logs.SQLEntry{SQL: sql, Args: stmt.vars, Rows: rows, Elapsed: elapsed, Err: err, Caller: utils.FileWithLineNum(), SlowThreshold: threshold})
+}
@@ -0,0 +1,73 @@
+package gormv2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// dryRunDialector builds the mysql style statements without a connection
+type dryRunDialector struct{}
+
+func (dryRunDialector) Name() string { return "dryrun" }
+func (dryRunDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+func (dryRunDialector) Migrator(db *gorm.DB) gorm.Migrator                          { return nil }
+func (dryRunDialector) DataTypeOf(*schema.Field) string                             { return "" }
+func (dryRunDialector) DefaultValueOf(*schema.Field) clause.Expression              { return nil }
+func (dryRunDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) { w.WriteByte('?') }
+func (dryRunDialector) QuoteTo(w clause.Writer, s string)                           { w.WriteString("`" + s + "`") }
+func (dryRunDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+type user struct {
+	ID       int64
+	Name     string
+	Password string
+}
+
+func TestTraceRedactArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gormv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	logs.LogInit(&logs.LogConf{OutPath: path})
+	defer logs.ClearLogger()
+
+	l := New()
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{Logger: l, DryRun: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(l); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&user{Name: "alice", Password: "p@ss-create"})
+	db.Model(&user{ID: 1}).Update("password", "p@ss-update")
+	db.Where("name = ?", "bob").Find(&[]user{})
+	logs.Sync()
+	data, _ := ioutil.ReadFile(path)
+	s := string(data)
+	if strings.Contains(s, "p@ss") {
+		t.Fatal(s)
+	}
+	for _, want := range []string{"VALUES ('alice','******')", "SET `password`='******'", "name = 'bob'"} {
+		if !strings.Contains(s, want) {
+			t.Fatal("missing", want, "in", s)
+		}
+	}
+}
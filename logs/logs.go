@@ -3,17 +3,17 @@
 package logs
 
 import (
-	"database/sql/driver"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"reflect"
 	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
-	"unicode"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -21,7 +21,14 @@ import (
 )
 
 var (
-	logger                       *XLogger
+	current                      atomic.Value
+	earlyLogger                  = newEarlyLogger()
+	initMu                       sync.Mutex
+	atomicLevel                  = zap.NewAtomicLevel()
+	baseLevel                    = zapcore.InfoLevel
+	levelMu                      sync.Mutex
+	levelTimer                   *time.Timer
+	levelGen                     int
 	gromDebugLogger              = log.New(os.Stdout, "\r\n", 0)
 	gromSQLRegexp                = regexp.MustCompile(`\?`)
 	gromNumericPlaceHolderRegexp = regexp.MustCompile(`\$\d+`)
@@ -32,12 +39,82 @@ type LogConf struct {
 	OutPath string `json:"outPath"`
 	Level   string `json:"level"`
 	Debug   bool   `json:"debug"`
+	//ErrorPath also write error logs to this file
+	ErrorPath string `json:"errorPath"`
+	//MaxSize max megabytes of a log file before it's rotated,default 100
+	MaxSize int `json:"maxSize"`
+	//MaxBackups max number of rotated files to keep,default 3
+	MaxBackups int `json:"maxBackups"`
+	//MaxAge max days to keep rotated files,default 28
+	MaxAge int `json:"maxAge"`
+	//Compress gzip the rotated files
+	Compress bool `json:"compress"`
+	//LocalTime use the local time in rotated file names,default UTC
+	LocalTime bool `json:"localTime"`
+	//Access access log config
+	Access *AccessLogConf `json:"access"`
+	//Outputs log outputs,replace OutPath if not empty
+	Outputs []*OutputConf `json:"outputs"`
+	//SQL sql log config,see SQLDriver
+	SQL *SQLLogConf `json:"sql"`
+	//Redact redaction config,default masks DefaultRedactFields
+	Redact *RedactConf `json:"redact"`
+}
+
+//AccessLogConf access log config
+type AccessLogConf struct {
+	//Disable turn off the access log
+	Disable bool `json:"disable"`
+	//OutPath write the access log to its own rotated file,empty writes to the app log
+	OutPath string `json:"outPath"`
+	//SampleRate log the fraction(0-1] of the successful requests,0 logs all,
+	//requests with status >= 400 are always logged
+	SampleRate float64 `json:"sampleRate"`
+	//ExcludePaths paths not logged,a trailing "*" matches the prefix
+	ExcludePaths []string `json:"excludePaths"`
+}
+
+func init() {
+	current.Store(earlyLogger)
 }
 
 //XLogger log
 type XLogger struct {
 	zap.Logger
-	logConf *LogConf
+	logConf  *LogConf
+	access   *zap.Logger
+	rotators []*lumberjack.Logger
+	closers  []io.Closer
+	redactor *redactor
+}
+
+//load returns the current logger,the buffering logger before LogInit
+func load() *XLogger {
+	return current.Load().(*XLogger)
+}
+
+//debug returns true if the logger is in debug mode
+func (l *XLogger) debug() bool {
+	return l.logConf != nil && l.logConf.Debug
+}
+
+//sync flush the buffered entries
+func (l *XLogger) sync() {
+	l.Logger.Sync()
+	if l.access != nil {
+		l.access.Sync()
+	}
+}
+
+//close flush and close the log files and connections
+func (l *XLogger) close() {
+	l.sync()
+	for _, r := range l.rotators {
+		r.Close()
+	}
+	for _, c := range l.closers {
+		c.Close()
+	}
 }
 
 //GormLogger Gorm log
@@ -46,7 +123,7 @@ type GormLogger struct {
 
 //Print Gorm日志打印
 func (*GormLogger) Print(v ...interface{}) {
-	if logger.logConf.Debug {
+	if load().debug() {
 		msg := gromLogFormatterDebug(v...)
 		if msg != nil {
 			gromDebugLogger.Println(msg...)
@@ -64,61 +141,179 @@ func (*GormLogger) Print(v ...interface{}) {
 	}
 }
 
-//LogInit 初始化日志库
+//LogInit 初始化日志库,已初始化时返回当前日志对象,
+//初始化前记录的日志会被缓存,初始化后写入
 func LogInit(conf *LogConf) *XLogger {
-	if logger == nil {
-		l := logLevel(conf.Level)
-		var w zapcore.WriteSyncer
-		var core zapcore.Core
-		if !conf.Debug {
-			encoderConfig := zap.NewProductionEncoderConfig()
-			//encoderConfig.LineEnding = zapcore.DefaultLineEnding
-			encoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-				enc.AppendString(t.Format("2006-01-02 15:04:05"))
-			}
-			w = zapcore.AddSync(&lumberjack.Logger{
-				Filename:   conf.OutPath,
-				MaxSize:    100, // megabytes
-				MaxBackups: 3,
-				MaxAge:     28, // days
-			})
-			core = zapcore.NewCore(
-				zapcore.NewJSONEncoder(encoderConfig),
-				w,
-				l,
-			)
-		} else {
-			encoderConfig := zap.NewDevelopmentEncoderConfig()
-			encoderConfig.LineEnding = zapcore.DefaultLineEnding
-			encoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-				enc.AppendString(t.Format("2006-01-02 15:04:05"))
-			}
+	initMu.Lock()
+	defer initMu.Unlock()
+	if l := load(); l != earlyLogger {
+		return l
+	}
+	return reinit(conf)
+}
+
+//Reinit 使用新配置重新初始化日志库(如配置重新加载后),
+//旧日志对象同步后关闭其日志文件和连接,运行时修改的日志级别恢复为配置的级别
+func Reinit(conf *LogConf) *XLogger {
+	initMu.Lock()
+	defer initMu.Unlock()
+	return reinit(conf)
+}
+
+func reinit(conf *LogConf) *XLogger {
+	if conf == nil {
+		conf = &LogConf{Outputs: []*OutputConf{{Type: "stdout", Encoder: "console"}}}
+	}
+	level := logLevel(conf.Level)
+	if conf.Debug {
+		level = zapcore.DebugLevel
+	}
+	levelMu.Lock()
+	if levelTimer != nil {
+		levelTimer.Stop()
+		levelTimer = nil
+	}
+	levelGen++
+	baseLevel = level
+	atomicLevel.SetLevel(level)
+	levelMu.Unlock()
+	l := newLogger(conf)
+	old := load()
+	current.Store(l)
+	early.flush(l.Core())
+	if old != earlyLogger {
+		old.close()
+	}
+	return l
+}
+
+//newLogger create the logger of conf
+func newLogger(conf *LogConf) *XLogger {
+	l := &XLogger{logConf: conf, redactor: newRedactor(conf.Redact)}
+	var w zapcore.WriteSyncer
+	var cores []zapcore.Core
+	var outputErr error
+	if len(conf.Outputs) > 0 {
+		cores, outputErr = l.outputCores()
+	} else if !conf.Debug {
+		w = zapcore.AddSync(l.rotator(conf.OutPath))
+		cores = []zapcore.Core{zapcore.NewCore(
+			zapcore.NewJSONEncoder(encoderConfig()),
+			w,
+			atomicLevel,
+		)}
+	} else {
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.LineEnding = zapcore.DefaultLineEnding
+		encoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(t.Format("2006-01-02 15:04:05"))
+		}
+
+		//jsonDebugging := zapcore.AddSync(ioutil.Discard)
+		//jsonErrors := zapcore.AddSync(ioutil.Discard)
+		consoleDebugging := zapcore.Lock(os.Stdout)
+		consoleErrors := zapcore.Lock(os.Stderr)
+
+		//jsonEncoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+		consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
+
+		cores = []zapcore.Core{
+			//zapcore.NewCore(jsonEncoder, jsonErrors, highPriority),
+			zapcore.NewCore(consoleEncoder, consoleErrors, zapcore.FatalLevel),
+			//zapcore.NewCore(jsonEncoder, jsonDebugging, lowPriority),
+			zapcore.NewCore(consoleEncoder, consoleDebugging, atomicLevel),
+		}
+
+		// w, _, _ = zap.Open("stdout")
+		// core = zapcore.NewCore(
+		// 	zapcore.NewConsoleEncoder(encoderConfig),
+		// 	w,
+		// 	l,
+		// )
+	}
+	if conf.ErrorPath != "" && !conf.Debug {
+		cores = append(cores, zapcore.NewCore(
+			zapcore.NewJSONEncoder(encoderConfig()),
+			zapcore.AddSync(l.rotator(conf.ErrorPath)),
+			zapcore.ErrorLevel,
+		))
+	}
+	l.Logger = *zap.New(l.redact(cores...))
+	if conf.Access != nil && conf.Access.OutPath != "" && !conf.Debug {
+		l.access = zap.New(l.redact(zapcore.NewCore(
+			zapcore.NewJSONEncoder(encoderConfig()),
+			zapcore.AddSync(l.rotator(conf.Access.OutPath)),
+			zapcore.InfoLevel,
+		)))
+	}
+	if outputErr != nil {
+		l.Logger.Error("log output error", zap.Error(outputErr))
+	}
+	return l
+}
+
+//redact tee the cores,the entries are masked by the redactor first
+func (l *XLogger) redact(cores ...zapcore.Core) zapcore.Core {
+	if l.redactor == nil {
+		if len(cores) == 1 {
+			return cores[0]
+		}
+		return zapcore.NewTee(cores...)
+	}
+	return &redactCore{cores: cores, r: l.redactor}
+}
 
-			//jsonDebugging := zapcore.AddSync(ioutil.Discard)
-			//jsonErrors := zapcore.AddSync(ioutil.Discard)
-			consoleDebugging := zapcore.Lock(os.Stdout)
-			consoleErrors := zapcore.Lock(os.Stderr)
-
-			//jsonEncoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
-			consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
-
-			core = zapcore.NewTee(
-				//zapcore.NewCore(jsonEncoder, jsonErrors, highPriority),
-				zapcore.NewCore(consoleEncoder, consoleErrors, zapcore.FatalLevel),
-				//zapcore.NewCore(jsonEncoder, jsonDebugging, lowPriority),
-				zapcore.NewCore(consoleEncoder, consoleDebugging, zapcore.DebugLevel),
-			)
-
-			// w, _, _ = zap.Open("stdout")
-			// core = zapcore.NewCore(
-			// 	zapcore.NewConsoleEncoder(encoderConfig),
-			// 	w,
-			// 	l,
-			// )
+//rotator create the rotated file writer of the logger
+func (l *XLogger) rotator(path string) *lumberjack.Logger {
+	conf := l.logConf
+	r := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    conf.MaxSize,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAge,
+		Compress:   conf.Compress,
+		LocalTime:  conf.LocalTime,
+	}
+	if r.MaxSize <= 0 {
+		r.MaxSize = 100 // megabytes
+	}
+	if r.MaxBackups <= 0 {
+		r.MaxBackups = 3
+	}
+	if r.MaxAge <= 0 {
+		r.MaxAge = 28 // days
+	}
+	l.rotators = append(l.rotators, r)
+	return r
+}
+
+//Rotate 立即切割所有日志文件(应用日志、错误日志、访问日志)
+func Rotate() error {
+	var err error
+	for _, r := range load().rotators {
+		if e := r.Rotate(); e != nil && err == nil {
+			err = e
 		}
-		logger = &XLogger{Logger: *zap.New(core), logConf: conf}
 	}
-	return logger
+	return err
+}
+
+//AccessConf returns the access log config,nil if not configured
+func AccessConf() *AccessLogConf {
+	if l := load(); l.logConf != nil {
+		return l.logConf.Access
+	}
+	return nil
+}
+
+//Access access log记录,写入独立的访问日志文件(如已配置)或应用日志
+func Access(msg string, fields ...zap.Field) {
+	l := load()
+	if l.access != nil {
+		l.access.Info(msg, fields...)
+	} else {
+		l.Info(msg, fields...)
+	}
 }
 
 //Info info日志记录
@@ -133,9 +328,7 @@ func I(msg string, fields ...zap.Field) {
 
 //InfoWithCaller info日志记录
 func InfoWithCaller(msg string, caller string, fields ...zap.Field) {
-	if logger != nil {
-		logger.Info(msg, LogCaller(caller, 0, fields...)...)
-	}
+	load().Info(msg, LogCaller(caller, 0, fields...)...)
 }
 
 //Debug debug日志记录
@@ -150,9 +343,22 @@ func D(msg string, fields ...zap.Field) {
 
 //DebugWithCaller debug日志记录
 func DebugWithCaller(msg string, caller string, fields ...zap.Field) {
-	if logger != nil {
-		logger.Debug(msg, LogCaller(caller, 0, fields...)...)
-	}
+	load().Debug(msg, LogCaller(caller, 0, fields...)...)
+}
+
+//Warn warn日志记录
+func Warn(msg string, fields ...zap.Field) {
+	WarnWithCaller(msg, "", fields...)
+}
+
+//W warn日志记录
+func W(msg string, fields ...zap.Field) {
+	WarnWithCaller(msg, "", fields...)
+}
+
+//WarnWithCaller warn日志记录
+func WarnWithCaller(msg string, caller string, fields ...zap.Field) {
+	load().Warn(msg, LogCaller(caller, 0, fields...)...)
 }
 
 //Error error日志记录
@@ -178,18 +384,17 @@ func Err(msg string, err error) {
 
 //ErrorWithCaller error日志记录
 func ErrorWithCaller(msg string, caller string, fields ...zap.Field) {
-	if logger != nil {
-		fields = LogCaller(caller, 0, fields...)
-		if logger.logConf.Debug {
-			fields = append(fields, zap.ByteString("stack", debug.Stack()))
-		}
-		logger.Error(msg, fields...)
+	l := load()
+	fields = LogCaller(caller, 0, fields...)
+	if l.debug() {
+		fields = append(fields, zap.ByteString("stack", debug.Stack()))
 	}
+	l.Error(msg, fields...)
 }
 
-//Logger 原始日志对象
+//Logger 原始日志对象,初始化前为缓存日志的对象
 func Logger() *XLogger {
-	return logger
+	return load()
 }
 
 //LoggerGorm Gorm日志对象
@@ -199,9 +404,7 @@ func LoggerGorm() *GormLogger {
 
 //Sync 同步
 func Sync() {
-	if logger != nil {
-		logger.Sync()
-	}
+	load().sync()
 }
 
 func logLevel(text string) zapcore.Level {
@@ -224,6 +427,54 @@ func logLevel(text string) zapcore.Level {
 	return zapcore.ErrorLevel
 }
 
+//ParseLevel parse the level text,debug|info|warn|error|dpanic|panic|fatal
+func ParseLevel(text string) (zapcore.Level, error) {
+	var l zapcore.Level
+	err := l.UnmarshalText([]byte(text))
+	return l, err
+}
+
+//Level returns the current level
+func Level() string {
+	return atomicLevel.Level().String()
+}
+
+//SetLevel 运行时修改日志级别,revert大于0时到期后恢复为配置的级别
+//param:
+//	level 日志级别(debug|info|warn|error)
+//	revert 恢复时间,0为不恢复
+func SetLevel(level string, revert time.Duration) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if levelTimer != nil {
+		levelTimer.Stop()
+		levelTimer = nil
+	}
+	atomicLevel.SetLevel(l)
+	levelGen++
+	if revert > 0 {
+		gen := levelGen
+		levelTimer = time.AfterFunc(revert, func() {
+			levelMu.Lock()
+			if gen != levelGen {
+				//changed again before the timer fired
+				levelMu.Unlock()
+				return
+			}
+			base := baseLevel
+			atomicLevel.SetLevel(base)
+			levelTimer = nil
+			levelMu.Unlock()
+			Info("log level reverted to " + base.String())
+		})
+	}
+	return nil
+}
+
 //LogCaller 获取调用链
 func LogCaller(caller string, skip int, fields ...zap.Field) []zap.Field {
 	if caller == "" {
@@ -270,11 +521,10 @@ func Caller(skip int) string {
 var gromLogFormatterDebug = func(values ...interface{}) (messages []interface{}) {
 	if len(values) > 1 {
 		var (
-			sql             string
-			formattedValues []string
-			level           = values[0]
-			currentTime     = "\n\033[33m[" + time.Now().Format("2006-01-02 15:04:05") + "]\033[0m"
-			source          = fmt.Sprintf("\033[35m(%v)\033[0m", values[1])
+			sql         string
+			level       = values[0]
+			currentTime = "\n\033[33m[" + time.Now().Format("2006-01-02 15:04:05") + "]\033[0m"
+			source      = fmt.Sprintf("\033[35m(%v)\033[0m", values[1])
 		)
 
 		messages = []interface{}{source, currentTime}
@@ -284,56 +534,7 @@ var gromLogFormatterDebug = func(values ...interface{}) (messages []interface{})
 			messages = append(messages, fmt.Sprintf(" \033[36;1m[%.2fms]\033[0m ", float64(values[2].(time.Duration).Nanoseconds()/1e4)/100.0))
 
 			// sql
-			vs := values[4].([]interface{})
-			for _, value := range vs {
-				indirectValue := reflect.Indirect(reflect.ValueOf(value))
-				if indirectValue.IsValid() {
-					value = indirectValue.Interface()
-					if t, ok := value.(time.Time); ok {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", t.Format("2006-01-02 15:04:05")))
-					} else if b, ok := value.([]byte); ok {
-						if str := string(b); isPrintable(str) {
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", str))
-						} else {
-							formattedValues = append(formattedValues, "'<binary>'")
-						}
-					} else if r, ok := value.(driver.Valuer); ok {
-						if value, err := r.Value(); err == nil && value != nil {
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-						} else {
-							formattedValues = append(formattedValues, "NULL")
-						}
-					} else {
-						switch value.(type) {
-						case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-							formattedValues = append(formattedValues, fmt.Sprintf("%v", value))
-							break
-						default:
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-						}
-					}
-				} else {
-					formattedValues = append(formattedValues, "NULL")
-				}
-			}
-
-			// differentiate between $n placeholders or else treat like ?
-			if gromNumericPlaceHolderRegexp.MatchString(values[3].(string)) {
-				sql = values[3].(string)
-				for index, value := range formattedValues {
-					placeholder := fmt.Sprintf(`\$%d([^\d]|$)`, index+1)
-					sql = regexp.MustCompile(placeholder).ReplaceAllString(sql, value+"$1")
-				}
-			} else {
-				formattedValuesLength := len(formattedValues)
-				vss := gromSQLRegexp.Split(values[3].(string), -1)
-				for index, value := range vss {
-					sql += value
-					if index < formattedValuesLength {
-						sql += formattedValues[index]
-					}
-				}
-			}
+			sql = formatSQL(values[3].(string), values[4].([]interface{}))
 			messages = append(messages, sql)
 			messages = append(messages, fmt.Sprintf(" \n\033[36;31m[%v]\033[0m ", strconv.FormatInt(values[5].(int64), 10)+" rows affected or returned "))
 
@@ -350,11 +551,10 @@ var gromLogFormatterDebug = func(values ...interface{}) (messages []interface{})
 var gromLogFormatter = func(values ...interface{}) (messages []zap.Field, levels string) {
 	if len(values) > 1 {
 		var (
-			sql             string
-			formattedValues []string
-			level           = values[0]
-			currentTime     = ""
-			source          = ""
+			sql         string
+			level       = values[0]
+			currentTime = ""
+			source      = ""
 		)
 		currentTime = time.Now().Format("2006-01-02 15:04:05")
 		source, _ = values[1].(string)
@@ -365,59 +565,10 @@ var gromLogFormatter = func(values ...interface{}) (messages []zap.Field, levels
 
 		if level == "sql" {
 			levels = "sql"
-			timeCost := strconv.FormatFloat(float64(values[2].(time.Duration).Nanoseconds()/1e4)/100.0, 'f', 0, 64) + "ms"
-			messages = append(messages, zap.String("timeCost", timeCost))
+			messages = append(messages, zap.String("timeCost", timeCost(values[2].(time.Duration))))
 
 			// sql
-			vs := values[4].([]interface{})
-			for _, value := range vs {
-				indirectValue := reflect.Indirect(reflect.ValueOf(value))
-				if indirectValue.IsValid() {
-					value = indirectValue.Interface()
-					if t, ok := value.(time.Time); ok {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", t.Format("2006-01-02 15:04:05")))
-					} else if b, ok := value.([]byte); ok {
-						if str := string(b); isPrintable(str) {
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", str))
-						} else {
-							formattedValues = append(formattedValues, "'<binary>'")
-						}
-					} else if r, ok := value.(driver.Valuer); ok {
-						if value, err := r.Value(); err == nil && value != nil {
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-						} else {
-							formattedValues = append(formattedValues, "NULL")
-						}
-					} else {
-						switch value.(type) {
-						case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-							formattedValues = append(formattedValues, fmt.Sprintf("%v", value))
-							break
-						default:
-							formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-						}
-					}
-				} else {
-					formattedValues = append(formattedValues, "NULL")
-				}
-			}
-			// differentiate between $n placeholders or else treat like ?
-			if gromNumericPlaceHolderRegexp.MatchString(values[3].(string)) {
-				sql = values[3].(string)
-				for index, value := range formattedValues {
-					placeholder := fmt.Sprintf(`\$%d([^\d]|$)`, index+1)
-					sql = regexp.MustCompile(placeholder).ReplaceAllString(sql, value+"$1")
-				}
-			} else {
-				formattedValuesLength := len(formattedValues)
-				vss := gromSQLRegexp.Split(values[3].(string), -1)
-				for index, value := range vss {
-					sql += value
-					if index < formattedValuesLength {
-						sql += formattedValues[index]
-					}
-				}
-			}
+			sql = formatSQL(values[3].(string), values[4].([]interface{}))
 			messages = append(messages, zap.String("sql", sql))
 			rowsAffected := values[5].(int64)
 			messages = append(messages, zap.Int64("rows", rowsAffected))
@@ -433,18 +584,13 @@ var gromLogFormatter = func(values ...interface{}) (messages []zap.Field, levels
 	return
 }
 
-func isPrintable(s string) bool {
-	for _, r := range s {
-		if !unicode.IsPrint(r) {
-			return false
-		}
-	}
-	return true
-}
-
-//ClearLogger 清空日志
+//ClearLogger 同步并关闭日志,之后记录的日志被缓存直到再次LogInit
 func ClearLogger() {
-	logger = nil
-	gromDebugLogger = nil
-	gromLogFormatter = nil
+	initMu.Lock()
+	defer initMu.Unlock()
+	old := load()
+	current.Store(earlyLogger)
+	if old != earlyLogger {
+		old.close()
+	}
 }
@@ -0,0 +1,115 @@
+package logs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ClearLogger()
+	//before init the entries are buffered
+	Info("early")
+	Debug("early debug")
+	LoggerGorm().Print("log", "gorm.go:1", "early gorm")
+	first := filepath.Join(dir, "first.log")
+	LogInit(&LogConf{OutPath: first})
+	if l := LogInit(&LogConf{OutPath: filepath.Join(dir, "ignored.log")}); l.logConf.OutPath != first {
+		t.Fatal("LogInit replaced the logger")
+	}
+	Info("first")
+
+	second := filepath.Join(dir, "second.log")
+	Reinit(&LogConf{OutPath: second, Level: "debug"})
+	Debug("second")
+	ClearLogger()
+	//safe after clear
+	Error("cleared")
+	LoggerGorm().Print("log", "gorm.go:2", "cleared gorm")
+	Sync()
+
+	data, _ := ioutil.ReadFile(first)
+	s := string(data)
+	if !strings.Contains(s, `"msg":"early"`) || !strings.Contains(s, "early gorm") || !strings.Contains(s, `"msg":"first"`) {
+		t.Fatal("first:", s)
+	}
+	if strings.Contains(s, "early debug") || strings.Contains(s, "second") {
+		t.Fatal("first:", s)
+	}
+	data, _ = ioutil.ReadFile(second)
+	if s = string(data); !strings.Contains(s, `"msg":"second"`) || strings.Contains(s, "cleared") {
+		t.Fatal("second:", s)
+	}
+
+	//the entries after ClearLogger go to the next logger
+	third := filepath.Join(dir, "third.log")
+	LogInit(&LogConf{OutPath: third})
+	defer ClearLogger()
+	Sync()
+	data, _ = ioutil.ReadFile(third)
+	if s = string(data); !strings.Contains(s, `"msg":"cleared"`) || !strings.Contains(s, "cleared gorm") {
+		t.Fatal("third:", s)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	Reinit(&LogConf{OutPath: path})
+	defer ClearLogger()
+	Info("before rotate")
+	if err := Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	Info("after rotate")
+	Sync()
+	files, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("rotated files=%v", files)
+	}
+	old, _ := ioutil.ReadFile(files[0])
+	cur, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(old), "before rotate") || strings.Contains(string(old), "after rotate") ||
+		!strings.Contains(string(cur), "after rotate") || strings.Contains(string(cur), "before rotate") {
+		t.Fatalf("rotated=%q,current=%q", old, cur)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	Reinit(&LogConf{Outputs: []*OutputConf{{Type: "stdout"}}, Level: "info"})
+	defer ClearLogger()
+	if err := SetLevel("verbose", 0); err == nil || Level() != "info" {
+		t.Fatal("invalid level is set:", Level())
+	}
+	if err := SetLevel("debug", 50*time.Millisecond); err != nil || Level() != "debug" {
+		t.Fatal(err, Level())
+	}
+	time.Sleep(150 * time.Millisecond)
+	if Level() != "info" {
+		t.Fatal("not reverted:", Level())
+	}
+
+	//a later change cancels the pending revert
+	SetLevel("debug", 50*time.Millisecond)
+	SetLevel("warn", 0)
+	time.Sleep(150 * time.Millisecond)
+	if Level() != "warn" {
+		t.Fatal("the pending revert fired:", Level())
+	}
+
+	//reinit applies the configured level and cancels the revert
+	SetLevel("debug", 50*time.Millisecond)
+	Reinit(&LogConf{Outputs: []*OutputConf{{Type: "stdout"}}, Level: "error"})
+	time.Sleep(150 * time.Millisecond)
+	if Level() != "error" {
+		t.Fatal("reinit level:", Level())
+	}
+}
@@ -0,0 +1,388 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+var bufferPool = buffer.NewPool()
+
+//OutputConf log output
+type OutputConf struct {
+	//Type file|stdout|stderr|syslog|tcp|udp
+	Type string `json:"type"`
+	//Path file path,host:port of tcp/udp,or syslog socket path(empty is the local syslog)
+	Path string `json:"path"`
+	//Level min level of the output,empty follows the logger level
+	Level string `json:"level"`
+	//Encoder json|console|logfmt,default json
+	Encoder string `json:"encoder"`
+	//Tag syslog tag,default the program name
+	Tag string `json:"tag"`
+}
+
+//encoderConfig returns the shared encoder config
+func encoderConfig() zapcore.EncoderConfig {
+	c := zap.NewProductionEncoderConfig()
+	c.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format("2006-01-02 15:04:05"))
+	}
+	return c
+}
+
+//newEncoder create the encoder by name
+func newEncoder(name string) (zapcore.Encoder, error) {
+	c := encoderConfig()
+	switch strings.ToLower(name) {
+	case "", "json":
+		return zapcore.NewJSONEncoder(c), nil
+	case "console":
+		c.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(c), nil
+	case "logfmt":
+		return newLogfmtEncoder(c), nil
+	}
+	return nil, errors.New("unknown log encoder " + name)
+}
+
+//outputLevel returns the level enabler of the output,
+//the output level is a floor on top of the logger(runtime) level
+func outputLevel(text string) (zapcore.LevelEnabler, error) {
+	if text == "" {
+		return atomicLevel, nil
+	}
+	min, err := ParseLevel(text)
+	if err != nil {
+		return nil, err
+	}
+	return zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= min && atomicLevel.Enabled(l)
+	}), nil
+}
+
+//newOutputCore create the core of the output,the files and connections are closed with the logger
+func (l *XLogger) newOutputCore(o *OutputConf) (zapcore.Core, error) {
+	enc, err := newEncoder(o.Encoder)
+	if err != nil {
+		return nil, err
+	}
+	level, err := outputLevel(o.Level)
+	if err != nil {
+		return nil, err
+	}
+	var w zapcore.WriteSyncer
+	switch strings.ToLower(o.Type) {
+	case "", "file":
+		if o.Path == "" {
+			return nil, errors.New("empty path of the file log output")
+		}
+		w = zapcore.AddSync(l.rotator(o.Path))
+	case "stdout":
+		w = zapcore.Lock(os.Stdout)
+	case "stderr":
+		w = zapcore.Lock(os.Stderr)
+	case "tcp", "udp":
+		if o.Path == "" {
+			return nil, errors.New("empty address of the " + o.Type + " log output")
+		}
+		nw := newNetWriter(strings.ToLower(o.Type), o.Path)
+		l.closers = append(l.closers, nw)
+		w = nw
+	case "syslog":
+		core, w, err := newSyslogCore(o, enc, level)
+		if err != nil {
+			return nil, err
+		}
+		l.closers = append(l.closers, w)
+		return core, nil
+	default:
+		return nil, errors.New("unknown log output " + o.Type)
+	}
+	return zapcore.NewCore(enc, w, level), nil
+}
+
+//outputCores create the cores of all outputs,a broken output is reported and skipped,
+//the logs are written to stderr if no output is available,the errors of the outputs are returned
+func (l *XLogger) outputCores() ([]zapcore.Core, error) {
+	cores := make([]zapcore.Core, 0, len(l.logConf.Outputs))
+	var errs error
+	for _, o := range l.logConf.Outputs {
+		if o == nil {
+			continue
+		}
+		core, err := l.newOutputCore(o)
+		if err != nil {
+			err = errors.New("log output " + o.Type + " " + o.Path + " error=" + err.Error())
+			fmt.Fprintln(os.Stderr, err.Error())
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		cores = append(cores, core)
+	}
+	if len(cores) == 0 {
+		cores = append(cores, zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig()), zapcore.Lock(os.Stderr), atomicLevel))
+		errs = multierr.Append(errs, errors.New("no log output is available,the logs are written to stderr"))
+	}
+	return cores, errs
+}
+
+const (
+	//netQueueSize max entries queued for a tcp/udp output,the later ones are dropped
+	netQueueSize = 1024
+	//netTimeout dial and write timeout of a tcp/udp output
+	netTimeout = 3 * time.Second
+	//netMaxBackoff max delay between the reconnects
+	netMaxBackoff = 30 * time.Second
+)
+
+//netWriter writes every entry as a line to a tcp or udp collector in the background,
+//the entries are queued and dropped if the queue is full or the collector is down,
+//so the logging goroutines never wait for the network,
+//it reconnects with a backoff from 1s doubled up to 30s
+type netWriter struct {
+	//dropped first for the 64-bit alignment of atomic
+	dropped       int64
+	network, addr string
+	queue         chan []byte
+	flush         chan chan struct{}
+	done, exited  chan struct{}
+	closeOnce     sync.Once
+	//conn,retry and backoff are used by the loop only
+	conn    net.Conn
+	retry   time.Time
+	backoff time.Duration
+}
+
+func newNetWriter(network, addr string) *netWriter {
+	w := &netWriter{
+		network: network,
+		addr:    addr,
+		queue:   make(chan []byte, netQueueSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+//Write queue a copy of p,it's dropped if the queue is full
+func (w *netWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	select {
+	case <-w.done:
+		return 0, errors.New("log output " + w.network + " " + w.addr + " closed")
+	default:
+	}
+	select {
+	case w.queue <- b:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+	return len(p), nil
+}
+
+//loop send the queued entries until closed
+func (w *netWriter) loop() {
+	defer close(w.exited)
+	for {
+		select {
+		case b := <-w.queue:
+			w.send(b)
+		case c := <-w.flush:
+			w.drain()
+			close(c)
+		case <-w.done:
+			w.drain()
+			if w.conn != nil {
+				w.conn.Close()
+				w.conn = nil
+			}
+			return
+		}
+	}
+}
+
+//drain send the queued entries
+func (w *netWriter) drain() {
+	for {
+		select {
+		case b := <-w.queue:
+			w.send(b)
+		default:
+			return
+		}
+	}
+}
+
+//send write the entry,connect if needed,the entry is dropped while the collector is down
+func (w *netWriter) send(b []byte) {
+	if w.conn == nil {
+		if time.Now().Before(w.retry) {
+			atomic.AddInt64(&w.dropped, 1)
+			return
+		}
+		conn, err := net.DialTimeout(w.network, w.addr, netTimeout)
+		if err != nil {
+			if w.backoff == 0 {
+				fmt.Fprintln(os.Stderr, "log output "+w.network+" "+w.addr+" error="+err.Error()+",the entries are dropped until it's reachable")
+				w.backoff = time.Second
+			} else if w.backoff *= 2; w.backoff > netMaxBackoff {
+				w.backoff = netMaxBackoff
+			}
+			w.retry = time.Now().Add(w.backoff)
+			atomic.AddInt64(&w.dropped, 1)
+			return
+		}
+		w.conn, w.backoff = conn, 0
+		if n := atomic.SwapInt64(&w.dropped, 0); n > 0 {
+			fmt.Fprintln(os.Stderr, "log output "+w.network+" "+w.addr+" reconnected,"+strconv.FormatInt(n, 10)+" entries were dropped")
+		}
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(netTimeout))
+	if _, err := w.conn.Write(b); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+//Sync wait until the queued entries are sent,at most the timeout
+func (w *netWriter) Sync() error {
+	c := make(chan struct{})
+	select {
+	case w.flush <- c:
+	case <-w.done:
+		return nil
+	case <-time.After(netTimeout):
+		return errors.New("log output " + w.network + " " + w.addr + " sync timeout")
+	}
+	select {
+	case <-c:
+		return nil
+	case <-time.After(netTimeout):
+		return errors.New("log output " + w.network + " " + w.addr + " sync timeout")
+	}
+}
+
+//Close send the queued entries and close the connection,at most the timeout
+func (w *netWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	select {
+	case <-w.exited:
+		return nil
+	case <-time.After(netTimeout):
+		return errors.New("log output " + w.network + " " + w.addr + " close timeout")
+	}
+}
+
+//logfmtEncoder encodes the entry as key=value pairs
+type logfmtEncoder struct {
+	*zapcore.MapObjectEncoder
+	conf zapcore.EncoderConfig
+}
+
+func newLogfmtEncoder(conf zapcore.EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), conf: conf}
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	c := newLogfmtEncoder(e.conf)
+	for k, v := range e.Fields {
+		c.Fields[k] = v
+	}
+	return c
+}
+
+func (e *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	m := zapcore.NewMapObjectEncoder()
+	for k, v := range e.Fields {
+		m.Fields[k] = v
+	}
+	for _, f := range fields {
+		f.AddTo(m)
+	}
+	buf := bufferPool.Get()
+	buf.AppendString("ts=")
+	buf.AppendString(ent.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+	buf.AppendString(" level=")
+	buf.AppendString(ent.Level.String())
+	if ent.LoggerName != "" {
+		buf.AppendString(" logger=")
+		appendLogfmtValue(buf, ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		buf.AppendString(" caller=")
+		appendLogfmtValue(buf, ent.Caller.TrimmedPath())
+	}
+	buf.AppendString(" msg=")
+	appendLogfmtValue(buf, ent.Message)
+	keys := make([]string, 0, len(m.Fields))
+	for k := range m.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.AppendByte(' ')
+		buf.AppendString(k)
+		buf.AppendByte('=')
+		appendLogfmtValue(buf, m.Fields[k])
+	}
+	if ent.Stack != "" {
+		buf.AppendString(" stack=")
+		appendLogfmtValue(buf, ent.Stack)
+	}
+	buf.AppendString(zapcore.DefaultLineEnding)
+	return buf, nil
+}
+
+//appendLogfmtValue append the value,quoted if needed
+func appendLogfmtValue(buf *buffer.Buffer, v interface{}) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	case time.Duration:
+		s = x.String()
+	case time.Time:
+		s = x.Format(time.RFC3339Nano)
+	case error:
+		s = x.Error()
+	case fmt.Stringer:
+		s = x.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		s = fmt.Sprint(x)
+	default:
+		data, err := json.Marshal(x)
+		if err != nil {
+			s = fmt.Sprint(x)
+		} else {
+			s = string(data)
+		}
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	buf.AppendString(s)
+}
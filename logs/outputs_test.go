@@ -0,0 +1,166 @@
+package logs
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	outputs := []*OutputConf{
+		{Type: "file", Path: filepath.Join(dir, "app.log"), Encoder: "logfmt"},
+		{Type: "tcp", Path: tcp.Addr().String(), Level: "error"},
+		{Type: "udp", Path: udp.LocalAddr().String(), Encoder: "console"},
+	}
+	var syslogConn net.PacketConn
+	if runtime.GOOS != "windows" {
+		sock := filepath.Join(dir, "syslog.sock")
+		if syslogConn, err = net.ListenPacket("unixgram", sock); err != nil {
+			t.Fatal(err)
+		}
+		defer syslogConn.Close()
+		outputs = append(outputs, &OutputConf{Type: "syslog", Path: sock, Tag: "bast", Level: "warn"})
+	}
+	LogInit(&LogConf{Level: "info", Outputs: outputs})
+	defer ClearLogger()
+
+	Info("hello world", zap.String("user", "a b"))
+	Error("failed")
+
+	tcpLines := make(chan string, 2)
+	go func() {
+		conn, err := tcp.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tcpLines <- line
+		}
+	}()
+	select {
+	case line := <-tcpLines:
+		if !strings.Contains(line, `"msg":"failed"`) {
+			t.Fatal("tcp:", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("tcp: no entry")
+	}
+
+	buf := make([]byte, 4096)
+	udp.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := udp.ReadFrom(buf)
+	if err != nil || !strings.Contains(string(buf[:n]), "INFO\thello world") {
+		t.Fatal("udp:", string(buf[:n]), err)
+	}
+
+	if syslogConn != nil {
+		syslogConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := syslogConn.ReadFrom(buf)
+		//<11> is user.err
+		if err != nil || !strings.HasPrefix(string(buf[:n]), "<11>") || !strings.Contains(string(buf[:n]), "failed") {
+			t.Fatal("syslog:", string(buf[:n]), err)
+		}
+	}
+
+	Sync()
+	data, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `level=info msg="hello world"`) || !strings.Contains(string(data), `user="a b"`) {
+		t.Fatal("file:", string(data))
+	}
+}
+
+func TestNetOutputDown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	w := newNetWriter("tcp", addr)
+	defer w.Close()
+	start := time.Now()
+	for i := 0; i < netQueueSize*3; i++ {
+		if _, err := w.Write([]byte("entry\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatal("write blocked", d)
+	}
+	w.Sync()
+	if atomic.LoadInt64(&w.dropped) == 0 {
+		t.Fatal("no entry dropped")
+	}
+
+	//the collector is back,the writer reconnects after the backoff
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	w.retry = time.Time{}
+	w.Write([]byte("back\n"))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "back\n" {
+		t.Fatal(line, err)
+	}
+}
+
+func TestOutputsFallback(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	Reinit(&LogConf{Outputs: []*OutputConf{{Type: "bogus"}, {Type: "tcp"}}})
+	os.Stderr = stderr
+	Info("fallback entry")
+	Sync()
+	ClearLogger()
+	w.Close()
+	data, _ := ioutil.ReadAll(r)
+	s := string(data)
+	if !strings.Contains(s, "unknown log output bogus") || !strings.Contains(s, `"msg":"log output error"`) ||
+		!strings.Contains(s, "written to stderr") || !strings.Contains(s, `"msg":"fallback entry"`) {
+		t.Fatal("stderr:", s)
+	}
+}
@@ -0,0 +1,303 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	//DefaultRedactFields the field names masked by default,matched case-insensitively as a part of the name
+	DefaultRedactFields = []string{"password", "passwd", "pwd", "secret", "token", "authorization", "cookie", "idcard", "id_card", "privatekey", "private_key"}
+	//DefaultRedactPatterns china id card and mobile phone numbers,opt-in by RedactConf.DefaultPatterns,
+	//they also match the other numbers of the same shape such as order ids
+	DefaultRedactPatterns = []string{
+		`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`,
+		`\b1[3-9]\d{9}\b`,
+	}
+	defaultRedactor = newRedactor(nil)
+	sqlInsertRegexp = regexp.MustCompile(`(?is)\(([^()]*)\)\s*values\s*\(`)
+	sqlColumnRegexp = regexp.MustCompile(`(?i)([\w.` + "`" + `"\[\]]+)\s*(?:=|<>|!=|<=|>=|<|>|\blike)\s*$`)
+)
+
+//RedactConf log redaction config,the values are masked before anything is written
+type RedactConf struct {
+	//Disable turn off the redaction
+	Disable bool `json:"disable"`
+	//Fields masked field names,empty uses DefaultRedactFields
+	Fields []string `json:"fields"`
+	//Patterns masked regexes of the values
+	Patterns []string `json:"patterns"`
+	//DefaultPatterns also mask DefaultRedactPatterns
+	DefaultPatterns bool `json:"defaultPatterns"`
+	//Mask the replacement,default ******
+	Mask string `json:"mask"`
+}
+
+//redactor masks the sensitive fields and text
+type redactor struct {
+	mask     string
+	names    []string
+	jsonRe   *regexp.Regexp
+	quotedRe *regexp.Regexp
+	kvRe     *regexp.Regexp
+	xmlRe    *regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+//newRedactor compile the config,nil if disabled
+func newRedactor(conf *RedactConf) *redactor {
+	if conf == nil {
+		conf = &RedactConf{}
+	}
+	if conf.Disable {
+		return nil
+	}
+	r := &redactor{mask: conf.Mask}
+	if r.mask == "" {
+		r.mask = "******"
+	}
+	fields := conf.Fields
+	if len(fields) == 0 {
+		fields = DefaultRedactFields
+	}
+	quoted := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			r.names = append(r.names, f)
+			quoted = append(quoted, regexp.QuoteMeta(f))
+		}
+	}
+	if len(quoted) > 0 {
+		name := `[\w-]*(?:` + strings.Join(quoted, "|") + `)[\w-]*`
+		r.jsonRe = regexp.MustCompile(`(?i)("` + name + `"\s*:\s*)("(?:[^"\\]|\\.)+"|[^,}\]\s"]+)`)
+		r.quotedRe = regexp.MustCompile(`(?i)\b(` + name + `\s*[=:]\s*')[^']*`)
+		r.kvRe = regexp.MustCompile(`(?i)\b(` + name + `\s*[=:]\s*)((?:bearer|basic)\s+[^\s&,;'"]+|[^\s&,;'"]+)`)
+		r.xmlRe = regexp.MustCompile(`(?i)(<[\w:-]*(?:` + strings.Join(quoted, "|") + `)[\w-]*(?:\s[^>]*)?>)[^<]*`)
+	}
+	patterns := conf.Patterns
+	if conf.DefaultPatterns {
+		patterns = append(DefaultRedactPatterns[:len(DefaultRedactPatterns):len(DefaultRedactPatterns)], patterns...)
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "log redact pattern "+p+" error="+err.Error())
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+//redactorOf returns the redactor of the current logger
+func redactorOf() *redactor {
+	if l := load(); l.logConf != nil {
+		return l.redactor
+	}
+	return defaultRedactor
+}
+
+//RedactText mask the sensitive values of the text,
+//such as the request body dumps,by the redaction config of the current logger
+func RedactText(s string) string {
+	return redactorOf().text(s)
+}
+
+//sensitive returns true if the field name is masked
+func (r *redactor) sensitive(key string) bool {
+	if r == nil || key == "" {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, n := range r.names {
+		if strings.Contains(key, n) {
+			return true
+		}
+	}
+	return false
+}
+
+//text mask the named values(json,key=value,xml) and the patterns
+func (r *redactor) text(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	if r.jsonRe != nil {
+		s = r.jsonRe.ReplaceAllString(s, `${1}"`+r.mask+`"`)
+		s = r.quotedRe.ReplaceAllString(s, "${1}"+r.mask)
+		s = r.kvRe.ReplaceAllString(s, "${1}"+r.mask)
+		s = r.xmlRe.ReplaceAllString(s, "${1}"+r.mask)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, r.mask)
+	}
+	return s
+}
+
+//field mask the field by its name or value
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	if r.sensitive(f.Key) {
+		return zap.String(f.Key, r.mask)
+	}
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.text(f.String)
+	case zapcore.ByteStringType:
+		if b, ok := f.Interface.([]byte); ok {
+			if s := r.text(string(b)); s != string(b) {
+				return zap.ByteString(f.Key, []byte(s))
+			}
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			if s := r.text(err.Error()); s != err.Error() {
+				return zap.String(f.Key, s)
+			}
+		}
+	case zapcore.StringerType:
+		if v, ok := f.Interface.(fmt.Stringer); ok && v != nil {
+			if s := v.String(); r.text(s) != s {
+				return zap.String(f.Key, r.text(s))
+			}
+		}
+	case zapcore.ReflectType:
+		if b, err := json.Marshal(f.Interface); err == nil {
+			if s := r.text(string(b)); s != string(b) {
+				return zap.Reflect(f.Key, json.RawMessage(s))
+			}
+		}
+	}
+	return f
+}
+
+//fields mask the fields,the slice is copied
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	fs := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		fs[i] = r.field(f)
+	}
+	return fs
+}
+
+//sqlArgs mask the args bound to the sensitive columns and the patterns of the string args,
+//the column of a placeholder is the left side of the comparison or the insert column
+func (r *redactor) sqlArgs(sql string, args []interface{}) []interface{} {
+	if r == nil || len(args) == 0 {
+		return args
+	}
+	vs := make([]interface{}, len(args))
+	copy(vs, args)
+	for i, v := range vs {
+		switch s := v.(type) {
+		case string:
+			vs[i] = r.text(s)
+		case []byte:
+			vs[i] = []byte(r.text(string(s)))
+		}
+	}
+	var locs [][]int
+	numeric := gromNumericPlaceHolderRegexp.MatchString(sql)
+	if numeric {
+		locs = gromNumericPlaceHolderRegexp.FindAllStringIndex(sql, -1)
+	} else {
+		locs = gromSQLRegexp.FindAllStringIndex(sql, -1)
+	}
+	var columns []string
+	valuesStart := -1
+	if m := sqlInsertRegexp.FindStringSubmatchIndex(sql); m != nil {
+		columns = strings.Split(sql[m[2]:m[3]], ",")
+		valuesStart = m[1]
+	}
+	prev, nth := 0, 0
+	for j, loc := range locs {
+		index := j
+		if numeric {
+			fmt.Sscanf(sql[loc[0]+1:loc[1]], "%d", &index)
+			index--
+		}
+		column := ""
+		if valuesStart >= 0 && loc[0] >= valuesStart && len(columns) > 0 && !sqlColumnRegexp.MatchString(sql[prev:loc[0]]) {
+			column = columns[nth%len(columns)]
+			nth++
+		} else if m := sqlColumnRegexp.FindStringSubmatch(sql[prev:loc[0]]); m != nil {
+			column = m[1]
+		}
+		prev = loc[1]
+		if index < 0 || index >= len(vs) {
+			continue
+		}
+		column = strings.Trim(strings.TrimSpace(column), "`\"[]")
+		if i := strings.LastIndexByte(column, '.'); i >= 0 {
+			column = column[i+1:]
+		}
+		if r.sensitive(column) {
+			vs[index] = r.mask
+		}
+	}
+	return vs
+}
+
+//redactCore masks the message and the fields once and writes the entry to the cores(a tee),
+//every core applies its own level
+type redactCore struct {
+	cores []zapcore.Core
+	r     *redactor
+}
+
+func (c *redactCore) Enabled(level zapcore.Level) bool {
+	for _, core := range c.cores {
+		if core.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	fields = c.r.fields(fields)
+	cores := make([]zapcore.Core, len(c.cores))
+	for i, core := range c.cores {
+		cores[i] = core.With(fields)
+	}
+	return &redactCore{cores: cores, r: c.r}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+//Write write the masked entry to the cores of the level,the errors are combined
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.text(ent.Message)
+	fields = c.r.fields(fields)
+	var err error
+	for _, core := range c.cores {
+		if core.Enabled(ent.Level) {
+			err = multierr.Append(err, core.Write(ent, fields))
+		}
+	}
+	return err
+}
+
+func (c *redactCore) Sync() error {
+	var err error
+	for _, core := range c.cores {
+		err = multierr.Append(err, core.Sync())
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package logs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRedactText(t *testing.T) {
+	r := newRedactor(nil)
+	for in, want := range map[string]string{
+		`{"name":"a","password":"p\"1","accessToken":12}`: `{"name":"a","password":"******","accessToken":"******"}`,
+		`user=a&pwd=secret1&x=1`:                          `user=a&pwd=******&x=1`,
+		`Authorization: Bearer abc.def`:                   `Authorization: ******`,
+		`<user><Password>p1</Password></user>`:            `<user><Password>******</Password></user>`,
+		`order 13812345678,id 11010519491231002X`:         `order 13812345678,id 11010519491231002X`,
+	} {
+		if got := r.text(in); got != want {
+			t.Fatal(got, "want", want)
+		}
+	}
+	in := `phone 13812345678,id 11010519491231002X,n 123456,code 9A`
+	if got := newRedactor(&RedactConf{DefaultPatterns: true, Patterns: []string{`\b\d[A-Z]\b`}}).text(in); got != `phone ******,id ******,n 123456,code ******` {
+		t.Fatal(got)
+	}
+	if r.sensitive("name") || !r.sensitive("userPwd") {
+		t.Fatal("sensitive")
+	}
+	if newRedactor(&RedactConf{Disable: true}).text(`pwd=1`) != `pwd=1` {
+		t.Fatal("disable")
+	}
+	for _, c := range []struct {
+		sql  string
+		args []interface{}
+		want string
+	}{
+		{"update `user` set `pwd`=?,name=? where u.token = ?", []interface{}{"s", "a", "t"}, "update `user` set `pwd`='******',name='a' where u.token = '******'"},
+		{"insert into user(name,password) values(?,?),(?,?)", []interface{}{"a", "s", "b", "s"}, "insert into user(name,password) values('a','******'),('b','******')"},
+		{"insert into user(name) values(?) on duplicate key update pwd=?", []interface{}{"a", "s"}, "insert into user(name) values('a') on duplicate key update pwd='******'"},
+		{"select * from user where name=$2 and password=$1", []interface{}{"s", "a"}, "select * from user where name='a' and password='******'"},
+		{"select * from orders where id=? and user_token like ?", []interface{}{"13812345678", "a"}, "select * from orders where id='13812345678' and user_token like '******'"},
+	} {
+		if got := formatSQL(c.sql, c.args); got != c.want {
+			t.Fatal(got, "want", c.want)
+		}
+	}
+}
+
+func TestRedactLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, errPath := filepath.Join(dir, "app.log"), filepath.Join(dir, "error.log")
+	LogInit(&LogConf{OutPath: path, ErrorPath: errPath, Redact: &RedactConf{Fields: []string{"pin"}, Mask: "#"}})
+	defer ClearLogger()
+	Info("login pin=1234", zap.String("pin", "1234"), zap.Any("form", map[string]string{"cardPin": "99"}), zap.Error(errors.New("bad pin=42")))
+	Logger().With(zap.String("userPin", "7")).Error("failed")
+	Sync()
+	data, _ := ioutil.ReadFile(path)
+	s := string(data)
+	//the values are matched with their context,the timestamp may contain the digits
+	if strings.Contains(s, "1234") || strings.Contains(s, `"99"`) || strings.Contains(s, "pin=42") || strings.Contains(s, `"7"`) {
+		t.Fatal(s)
+	}
+	if !strings.Contains(s, `"msg":"login pin=#"`) || !strings.Contains(s, `"form":{"cardPin":"#"}`) {
+		t.Fatal(s)
+	}
+	data, _ = ioutil.ReadFile(errPath)
+	if s = string(data); strings.Contains(s, "login") || !strings.Contains(s, `"userPin":"#"`) {
+		t.Fatal("error log:", s)
+	}
+}
+
+//failWriter fails every write
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+func (failWriter) Sync() error                 { return nil }
+
+func TestRedactCoreWriteError(t *testing.T) {
+	l := &XLogger{redactor: newRedactor(nil)}
+	core := l.redact(zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig()), failWriter{}, zapcore.DebugLevel))
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "pwd=1"}, nil); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatal("err=", err)
+	}
+}
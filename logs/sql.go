@@ -0,0 +1,180 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+//SQLLogConf sql log config
+type SQLLogConf struct {
+	//SlowThreshold queries slower than it(milliseconds) are logged as warnings with slow=true,0 disables
+	SlowThreshold int `json:"slowThreshold"`
+	//SlowOnly log only the slow and failed queries
+	SlowOnly bool `json:"slowOnly"`
+}
+
+//SQLEntry an executed sql statement
+type SQLEntry struct {
+	//SQL the statement
+	SQL string
+	//Args the args,interpolated into SQL in the log
+	Args []interface{}
+	//Rows rows affected or returned,-1 is unknown
+	Rows int64
+	//Elapsed the duration
+	Elapsed time.Duration
+	//Err the error
+	Err error
+	//Caller the caller,empty is the first caller outside database/sql,gorm and logs
+	Caller string
+	//SlowThreshold overrides SQLLogConf.SlowThreshold if not 0
+	SlowThreshold time.Duration
+}
+
+//SQLConf returns the sql log config,nil if not configured
+func SQLConf() *SQLLogConf {
+	if l := load(); l.logConf != nil {
+		return l.logConf.SQL
+	}
+	return nil
+}
+
+//LogSQL 记录sql日志,失败为error级别,超过慢查询阈值为warn级别并标记slow,其余为info级别
+//param:
+//	ctx 上下文,记录其中的requestId
+//	e 执行的sql
+func LogSQL(ctx context.Context, e *SQLEntry) {
+	conf := SQLConf()
+	threshold := e.SlowThreshold
+	if threshold == 0 && conf != nil {
+		threshold = time.Duration(conf.SlowThreshold) * time.Millisecond
+	}
+	slow := threshold > 0 && e.Elapsed > threshold
+	if e.Err == nil && !slow && conf != nil && conf.SlowOnly {
+		return
+	}
+	caller := e.Caller
+	if caller == "" {
+		caller = sqlCaller()
+	}
+	fields := make([]zap.Field, 0, 8)
+	fields = append(fields, zap.String("sql", formatSQL(e.SQL, e.Args)), zap.String("timeCost", timeCost(e.Elapsed)))
+	if e.Rows >= 0 {
+		fields = append(fields, zap.Int64("rows", e.Rows))
+	}
+	fields = WithRequestID(ctx, fields...)
+	switch {
+	case e.Err != nil:
+		fields = append(fields, zap.String("error", e.Err.Error()))
+		ErrorWithCaller("sql", caller, fields...)
+	case slow:
+		fields = append(fields, zap.Bool("slow", true))
+		WarnWithCaller("sql", caller, fields...)
+	default:
+		InfoWithCaller("sql", caller, fields...)
+	}
+}
+
+//sqlCaller returns the first caller outside database/sql,gorm and this package
+func sqlCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "database/sql") &&
+			!strings.HasPrefix(f.Function, "gorm.io/") &&
+			!strings.HasPrefix(f.Function, "github.com/jinzhu/gorm") &&
+			(!strings.HasPrefix(f.Function, "github.com/aixiaoxiang/bast/logs") || strings.HasSuffix(f.File, "_test.go")) &&
+			!strings.HasPrefix(f.Function, "runtime.") {
+			return f.File + ":" + strconv.Itoa(f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+//timeCost format the duration as milliseconds
+func timeCost(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Nanoseconds()/1e4)/100.0, 'f', 0, 64) + "ms"
+}
+
+//formatSQL interpolate the args into the ? or $n placeholders of the sql,the sensitive values are masked
+func formatSQL(sql string, args []interface{}) string {
+	r := redactorOf()
+	if len(args) == 0 {
+		return r.text(sql)
+	}
+	args = r.sqlArgs(sql, args)
+	var formattedValues []string
+	for _, value := range args {
+		indirectValue := reflect.Indirect(reflect.ValueOf(value))
+		if indirectValue.IsValid() {
+			value = indirectValue.Interface()
+			if t, ok := value.(time.Time); ok {
+				formattedValues = append(formattedValues, fmt.Sprintf("'%v'", t.Format("2006-01-02 15:04:05")))
+			} else if b, ok := value.([]byte); ok {
+				if str := string(b); isPrintable(str) {
+					formattedValues = append(formattedValues, fmt.Sprintf("'%v'", str))
+				} else {
+					formattedValues = append(formattedValues, "'<binary>'")
+				}
+			} else if r, ok := value.(driver.Valuer); ok {
+				if value, err := r.Value(); err == nil && value != nil {
+					formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
+				} else {
+					formattedValues = append(formattedValues, "NULL")
+				}
+			} else {
+				switch value.(type) {
+				case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+					formattedValues = append(formattedValues, fmt.Sprintf("%v", value))
+				default:
+					formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
+				}
+			}
+		} else {
+			formattedValues = append(formattedValues, "NULL")
+		}
+	}
+	// differentiate between $n placeholders or else treat like ?
+	if gromNumericPlaceHolderRegexp.MatchString(sql) {
+		for index, value := range formattedValues {
+			placeholder := fmt.Sprintf(`\$%d([^\d]|$)`, index+1)
+			sql = regexp.MustCompile(placeholder).ReplaceAllString(sql, value+"$1")
+		}
+		return r.text(sql)
+	}
+	var s string
+	formattedValuesLength := len(formattedValues)
+	vss := gromSQLRegexp.Split(sql, -1)
+	for index, value := range vss {
+		s += value
+		if index < formattedValuesLength {
+			s += formattedValues[index]
+		}
+	}
+	return r.text(s)
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
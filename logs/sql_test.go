@@ -0,0 +1,114 @@
+package logs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//registerFake registers the fake driver once,the tests may run more than once
+var registerFake sync.Once
+
+//fakeDriver returns two rows for queries,fails on "bad" and sleeps on "slow"
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct{ query string }
+
+type fakeRows struct{ n int }
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return strings.Count(s.query, "?") }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "bad") {
+		return nil, errors.New("syntax error")
+	}
+	if strings.Contains(s.query, "slow") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return driver.RowsAffected(3), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 2 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = int64(r.n)
+	return nil
+}
+
+func TestSQLDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sql.log")
+	LogInit(&LogConf{OutPath: path, SQL: &SQLLogConf{SlowThreshold: 10}})
+	defer ClearLogger()
+
+	registerFake.Do(func() { sql.Register("logs-fake", SQLDriver(fakeDriver{})) })
+	db, err := sql.Open("logs-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.WithValue(context.Background(), RequestIDKey, "req-1")
+	if _, err := db.ExecContext(ctx, "update t set name=? where id=?", "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, "select id from t where id>?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if _, err := db.Exec("bad sql"); err == nil {
+		t.Fatal("expected error")
+	}
+	db.Exec("slow sql")
+	Sync()
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatal(string(data))
+	}
+	for i, want := range []string{
+		`"sql":"update t set name='a' where id=1"`,
+		`"sql":"select id from t where id>0"`,
+		`"level":"error"`,
+		`"slow":true`,
+	} {
+		if !strings.Contains(lines[i], want) {
+			t.Fatal(lines[i], "want", want)
+		}
+	}
+	if !strings.Contains(lines[0], `"rows":3`) || !strings.Contains(lines[0], `"requestId":"req-1"`) || !strings.Contains(lines[1], `"rows":2`) {
+		t.Fatal(string(data))
+	}
+	if !strings.Contains(lines[0], "sql_test.go") {
+		t.Fatal("caller:", lines[0])
+	}
+}
@@ -0,0 +1,359 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package logs
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"time"
+)
+
+//SQLDriver wrap the database/sql driver to log every statement with LogSQL,
+//the slow threshold is read from LogConf.SQL
+//	sql.Register("mysql-log", logs.SQLDriver(&mysql.MySQLDriver{}))
+//	db, err := sql.Open("mysql-log", dsn)
+func SQLDriver(d driver.Driver) driver.Driver {
+	return &sqlDriver{Driver: d}
+}
+
+//SQLConnector wrap the database/sql connector to log every statement with LogSQL
+//	db := sql.OpenDB(logs.SQLConnector(connector))
+func SQLConnector(c driver.Connector) driver.Connector {
+	return &sqlConnector{Connector: c, driver: SQLDriver(c.Driver())}
+}
+
+type sqlDriver struct {
+	driver.Driver
+}
+
+func (d *sqlDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{Conn: c}, nil
+}
+
+func (d *sqlDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlConnector{Connector: c, driver: d}, nil
+	}
+	return &dsnConnector{name: name, driver: d}, nil
+}
+
+type sqlConnector struct {
+	driver.Connector
+	driver driver.Driver
+}
+
+func (c *sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{Conn: conn}, nil
+}
+
+func (c *sqlConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+//dsnConnector the connector of a driver without DriverContext
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+//logStatement log the executed statement
+func logStatement(ctx context.Context, query string, args []driver.NamedValue, rows int64, elapsed time.Duration, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	vs := make([]interface{}, len(args))
+	for i, a := range args {
+		vs[i] = a.Value
+	}
+	LogSQL(ctx, &SQLEntry{SQL: query, Args: vs, Rows: rows, Elapsed: elapsed, Err: err})
+}
+
+//resultRows returns the rows affected,-1 if unknown
+func resultRows(r driver.Result) int64 {
+	if r == nil {
+		return -1
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+//namedValues convert the ordinal args
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nvs
+}
+
+//values convert the named args back,named args are not supported
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	vs := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		vs[i] = a.Value
+	}
+	return vs, nil
+}
+
+type sqlConn struct {
+	driver.Conn
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStmt{Stmt: s, conn: c.Conn, query: query}, nil
+}
+
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var r driver.Result
+	var err error
+	if ec, ok := c.Conn.(driver.ExecerContext); ok {
+		r, err = ec.ExecContext(ctx, query, args)
+	} else if e, ok := c.Conn.(driver.Execer); ok {
+		var vs []driver.Value
+		if vs, err = values(args); err == nil {
+			r, err = e.Exec(query, vs)
+		}
+	} else {
+		return nil, driver.ErrSkip
+	}
+	logStatement(ctx, query, args, resultRows(r), time.Since(start), err)
+	return r, err
+}
+
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := c.Conn.(driver.QueryerContext); ok {
+		rows, err = qc.QueryContext(ctx, query, args)
+	} else if q, ok := c.Conn.(driver.Queryer); ok {
+		var vs []driver.Value
+		if vs, err = values(args); err == nil {
+			rows, err = q.Query(query, vs)
+		}
+	} else {
+		return nil, driver.ErrSkip
+	}
+	if err != nil {
+		logStatement(ctx, query, args, -1, time.Since(start), err)
+		return nil, err
+	}
+	return &sqlRows{Rows: rows, ctx: ctx, query: query, args: args, elapsed: time.Since(start)}, nil
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type sqlStmt struct {
+	driver.Stmt
+	conn  driver.Conn
+	query string
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var r driver.Result
+	var err error
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		r, err = ec.ExecContext(ctx, args)
+	} else {
+		var vs []driver.Value
+		if vs, err = values(args); err == nil {
+			r, err = s.Stmt.Exec(vs)
+		}
+	}
+	logStatement(ctx, s.query, args, resultRows(r), time.Since(start), err)
+	return r, err
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		var vs []driver.Value
+		if vs, err = values(args); err == nil {
+			rows, err = s.Stmt.Query(vs)
+		}
+	}
+	if err != nil {
+		logStatement(ctx, s.query, args, -1, time.Since(start), err)
+		return nil, err
+	}
+	return &sqlRows{Rows: rows, ctx: ctx, query: s.query, args: args, elapsed: time.Since(start)}, nil
+}
+
+func (s *sqlStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	if nc, ok := s.conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (s *sqlStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+//sqlRows counts the rows,the query is logged when the rows are closed
+type sqlRows struct {
+	driver.Rows
+	ctx     context.Context
+	query   string
+	args    []driver.NamedValue
+	elapsed time.Duration
+	count   int64
+	err     error
+	closed  bool
+}
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *sqlRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		logStatement(r.ctx, r.query, r.args, r.count, r.elapsed, r.err)
+	}
+	return err
+}
+
+func (r *sqlRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *sqlRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *sqlRows) ColumnTypeScanType(index int) reflect.Type {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return rs.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *sqlRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rs.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *sqlRows) ColumnTypeLength(index int) (int64, bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return rs.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *sqlRows) ColumnTypeNullable(index int) (bool, bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return rs.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *sqlRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if rs, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return rs.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
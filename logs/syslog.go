@@ -0,0 +1,78 @@
+// +build !windows
+
+package logs
+
+import (
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap/zapcore"
+)
+
+//syslogCore writes the entries to syslog with the matching priority
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *syslog.Writer
+}
+
+//newSyslogCore dial the syslog socket,empty path is the local syslog
+func newSyslogCore(o *OutputConf, enc zapcore.Encoder, level zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	tag := o.Tag
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	var w *syslog.Writer
+	var err error
+	if o.Path == "" {
+		w, err = syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	} else {
+		w, err = syslog.Dial("unixgram", o.Path, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &syslogCore{LevelEnabler: level, enc: enc, w: w}, w, nil
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &syslogCore{LevelEnabler: c.LevelEnabler, enc: enc, w: c.w}
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	msg := buf.String()
+	buf.Free()
+	switch {
+	case ent.Level >= zapcore.DPanicLevel:
+		return c.w.Crit(msg)
+	case ent.Level >= zapcore.ErrorLevel:
+		return c.w.Err(msg)
+	case ent.Level >= zapcore.WarnLevel:
+		return c.w.Warning(msg)
+	case ent.Level >= zapcore.InfoLevel:
+		return c.w.Info(msg)
+	default:
+		return c.w.Debug(msg)
+	}
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
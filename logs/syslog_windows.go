@@ -0,0 +1,15 @@
+// +build windows
+
+package logs
+
+import (
+	"errors"
+	"io"
+
+	"go.uber.org/zap/zapcore"
+)
+
+//newSyslogCore syslog is not supported on windows
+func newSyslogCore(o *OutputConf, enc zapcore.Encoder, level zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	return nil, nil, errors.New("syslog is not supported on windows")
+}
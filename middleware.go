@@ -0,0 +1,40 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+//Middleware is request middleware,
+//call next(ctx) to continue the chain,return without calling next to stop it
+type Middleware func(ctx *Context, next func(ctx *Context))
+
+//Use registers the global middleware,
+//applied to every route in the order registered
+func Use(m ...Middleware) {
+	app.middlewares = append(app.middlewares, m...)
+}
+
+//Use registers the route middleware,applied after the global middleware
+func (r *Route) Use(m ...Middleware) *Route {
+	r.middlewares = append(r.middlewares, m...)
+	return r
+}
+
+//chain returns the route middleware chain,global,group then route
+func (r *Route) chain() []Middleware {
+	ms := make([]Middleware, 0, len(app.middlewares)+len(r.middlewares))
+	ms = append(ms, app.middlewares...)
+	if r.group != nil {
+		ms = append(ms, r.group.allMiddlewares()...)
+	}
+	ms = append(ms, r.middlewares...)
+	return ms
+}
+
+//next call the middleware at index,then the final handler
+func next(ms []Middleware, index int, final func(ctx *Context)) func(ctx *Context) {
+	if index >= len(ms) {
+		return final
+	}
+	return func(ctx *Context) {
+		ms[index](ctx, next(ms, index+1, final))
+	}
+}
@@ -0,0 +1,10 @@
+// +build !linux,!windows
+
+package pipe
+
+import "net"
+
+//samePeer the private directory restricts the peers
+func samePeer(c net.Conn) bool {
+	return true
+}
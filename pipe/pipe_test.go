@@ -0,0 +1,60 @@
+// +build !windows
+
+package pipe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	name := "pipe-test-" + strconv.Itoa(os.Getpid())
+	Remove(name)
+	l, err := Listen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Remove(name)
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte("pong"))
+		c.Close()
+	}()
+	c, err := Dial(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(c)
+	c.Close()
+	if string(data) != "pong" {
+		t.Fatalf("read %q", data)
+	}
+	fi, err := os.Stat(pipeDir())
+	if err != nil || fi.Mode().Perm() != 0700 {
+		t.Fatalf("pipe directory mode=%v,err=%v", fi.Mode(), err)
+	}
+	fi, err = os.Stat(filepath.Join(pipeDir(), name))
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("pipe mode=%v,err=%v", fi.Mode(), err)
+	}
+}
+
+func TestPrivateDir(t *testing.T) {
+	if err := os.Chmod(pipeDir(), 0777); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	dir, err := privateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(dir); fi.Mode().Perm() != 0700 {
+		t.Fatalf("the open directory is not fixed,mode=%v", fi.Mode())
+	}
+}
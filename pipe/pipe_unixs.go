@@ -3,18 +3,89 @@
 package pipe
 
 import (
+	"errors"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
 )
 
 // Listen creates a listener on a Windows named pipe path
 // on windows e.g. \\.\pipe\mypipe.
-// on unix /tmp/mypipe
+// on unix /tmp/pipe-<uid>/mypipe,the directory is only accessible by the user,
+// the socket is 0600 and the connections of the other users are rejected
 // The pipe must not already exist.
 func Listen(name string) (net.Listener, error) {
-	return net.Listen("unix", "/tmp/"+name)
+	dir, err := privateDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &peerListener{l}, nil
 }
 
 //Dial net.Dial by wrap
 func Dial(name string) (net.Conn, error) {
-	return net.Dial("unix", "/tmp/"+name)
+	return net.Dial("unix", filepath.Join(pipeDir(), name))
+}
+
+//Remove remove the stale socket file of the pipe
+func Remove(name string) error {
+	return os.Remove(filepath.Join(pipeDir(), name))
+}
+
+//pipeDir returns the pipe directory of the user
+func pipeDir() string {
+	return "/tmp/pipe-" + strconv.Itoa(os.Getuid())
+}
+
+//privateDir create the pipe directory,
+//it must be a directory owned by the user and only accessible by the user
+func privateDir() (string, error) {
+	dir := pipeDir()
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() {
+		return "", errors.New("pipe: " + dir + " is not a directory of the user")
+	}
+	if fi.Mode().Perm() != 0700 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+//peerListener rejects the connections of the other users
+type peerListener struct {
+	net.Listener
+}
+
+//Accept returns the next connection of the user
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if samePeer(c) {
+			return c, nil
+		}
+		c.Close()
+	}
 }
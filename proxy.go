@@ -0,0 +1,185 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	//trustedNets the trusted proxy networks,[]*net.IPNet
+	trustedNets atomic.Value
+	//defaultTrustedProxies loopback only
+	defaultTrustedProxies = []string{"127.0.0.1/8", "::1/128"}
+)
+
+func init() {
+	TrustedProxies(defaultTrustedProxies...)
+}
+
+//TrustedProxies set the trusted proxy CIDRs(a plain ip is a single host),
+//Forwarded,X-Forwarded-*,X-Real-IP and BaseUrl headers are honored only from these hops,
+//default loopback only
+//	bast.TrustedProxies("10.0.0.0/8", "172.16.0.0/12")
+func TrustedProxies(cidrs ...string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	trustedNets.Store(nets)
+	return nil
+}
+
+//parseCIDRs parse the CIDR list
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+//containsIP returns true if ip is in nets
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//isTrustedProxy returns true if the address is a trusted proxy
+func isTrustedProxy(addr string) bool {
+	nets, _ := trustedNets.Load().([]*net.IPNet)
+	return containsIP(nets, net.ParseIP(addr))
+}
+
+//forwardedElement is an element of the Forwarded header(RFC 7239)
+type forwardedElement struct {
+	For, Proto, Host string
+}
+
+//parseForwarded parse the Forwarded headers,the client side first
+func parseForwarded(h http.Header) []forwardedElement {
+	var es []forwardedElement
+	for _, v := range h["Forwarded"] {
+		for _, part := range strings.Split(v, ",") {
+			e := forwardedElement{}
+			for _, pair := range strings.Split(part, ";") {
+				i := strings.IndexByte(pair, '=')
+				if i < 0 {
+					continue
+				}
+				val := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+				switch strings.ToLower(strings.TrimSpace(pair[:i])) {
+				case "for":
+					e.For = forwardedIP(val)
+				case "proto":
+					e.Proto = strings.ToLower(val)
+				case "host":
+					e.Host = val
+				}
+			}
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+//forwardedIP strip the port and brackets of the node
+func forwardedIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if i := strings.IndexByte(node, ']'); i > 0 {
+			return node[1:i]
+		}
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+//clientIP returns the client ip of the request,see Context.ClientIP
+func clientIP(req *http.Request) string {
+	ip := remoteIP(req)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	if e, i := forwarded(req); i >= 0 && e.For != "" {
+		return e.For
+	}
+	if v := req.Header.Get("X-Forwarded-For"); v != "" {
+		hops := strings.Split(v, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := forwardedIP(strings.TrimSpace(hops[i]))
+			if hop != "" && (i == 0 || !isTrustedProxy(hop)) {
+				return hop
+			}
+		}
+	}
+	if v := strings.TrimSpace(req.Header.Get("X-Real-IP")); v != "" {
+		return v
+	}
+	return ip
+}
+
+//remoteIP returns the ip of the direct peer
+func remoteIP(req *http.Request) string {
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return ip
+	}
+	return req.RemoteAddr
+}
+
+//fromTrustedProxy returns true if the direct peer is a trusted proxy
+func (c *Context) fromTrustedProxy() bool {
+	return isTrustedProxy(remoteIP(c.Request))
+}
+
+//forwarded returns the element of the Forwarded header added by the nearest trusted hop
+//for the right-most untrusted address,index is -1 if there is no such element
+func forwarded(req *http.Request) (forwardedElement, int) {
+	es := parseForwarded(req.Header)
+	for i := len(es) - 1; i >= 0; i-- {
+		if i == 0 || !isTrustedProxy(es[i].For) {
+			return es[i], i
+		}
+	}
+	return forwardedElement{}, -1
+}
+
+//lastHeaderValue returns the right-most value of the comma-separated header,
+//it's appended by the nearest proxy,the left ones may be sent by the client
+func lastHeaderValue(h http.Header, key string) string {
+	vs := h[http.CanonicalHeaderKey(key)]
+	if len(vs) == 0 {
+		return ""
+	}
+	v := vs[len(vs)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
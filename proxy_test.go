@@ -0,0 +1,76 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+//forwardedGet send the request with the headers,returns the scheme,host and client ip seen by the handler
+func forwardedGet(t *testing.T, url string, header map[string]string) map[string]string {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	r := map[string]string{}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+//forwardedServer serve the scheme,host and client ip of the request
+func forwardedServer(t *testing.T) string {
+	return serveRoute(t, newTestRoute(func(ctx *Context) {
+		ctx.JSONResult(map[string]string{"scheme": ctx.Scheme(), "host": ctx.Host(), "ip": ctx.ClientIP()})
+	})).URL
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	setTestProxies(t, defaultTrustedProxies...)
+	url := forwardedServer(t)
+	tests := []struct {
+		name                   string
+		header                 map[string]string
+		scheme, host, clientIP string
+	}{
+		{"no forwarded headers", nil, "http", "", "127.0.0.1"},
+		{"x-forwarded", map[string]string{"X-Forwarded-Proto": "HTTPS", "X-Forwarded-Host": "example.com", "X-Forwarded-For": "1.2.3.4"}, "https", "example.com", "1.2.3.4"},
+		{"spoofed left-most values", map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, example.com", "X-Forwarded-For": "6.6.6.6, 1.2.3.4"}, "http", "example.com", "1.2.3.4"},
+		{"x-forwarded-ssl", map[string]string{"X-Forwarded-Ssl": "on"}, "https", "", "127.0.0.1"},
+		{"forwarded", map[string]string{"Forwarded": `for=6.6.6.6;proto=http;host=evil.com, for=1.2.3.4;proto=https;host=example.com`}, "https", "example.com", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		r := forwardedGet(t, url+"/test", tt.header)
+		host := tt.host
+		if host == "" {
+			host = url[len("http://"):]
+		}
+		if r["scheme"] != tt.scheme || r["host"] != host || r["ip"] != tt.clientIP {
+			t.Errorf("%s: got %v,want scheme=%s host=%s ip=%s", tt.name, r, tt.scheme, host, tt.clientIP)
+		}
+	}
+}
+
+func TestUntrustedProxy(t *testing.T) {
+	//the loopback test client isn't trusted
+	setTestProxies(t, "10.0.0.0/8")
+	url := forwardedServer(t)
+	r := forwardedGet(t, url+"/test", map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "example.com",
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Real-IP":         "1.2.3.4",
+		"Forwarded":         "for=1.2.3.4;proto=https;host=example.com",
+	})
+	if r["scheme"] != "http" || r["host"] != url[len("http://"):] || r["ip"] != "127.0.0.1" {
+		t.Errorf("the untrusted forwarded headers are used:%v", r)
+	}
+}
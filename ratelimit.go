@@ -0,0 +1,339 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//rate limit algorithms
+const (
+	//TokenBucket allows bursts up to Burst and refills Limit tokens every Period
+	TokenBucket = "tokenBucket"
+	//SlidingWindow allows Limit requests in any Period(weighted sliding window counter)
+	SlidingWindow = "slidingWindow"
+)
+
+//RateLimitConf rate limit policy
+type RateLimitConf struct {
+	//Algorithm tokenBucket|slidingWindow,default tokenBucket
+	Algorithm string `json:"algorithm"`
+	//Limit requests allowed per Period
+	Limit int `json:"limit"`
+	//Period period(seconds),default 1
+	Period int `json:"period"`
+	//Burst token bucket capacity,default Limit
+	Burst int `json:"burst"`
+	//Key ip|user|header:<name>,default ip,used if KeyFunc is nil
+	Key string `json:"key"`
+	//KeyFunc returns the key of the request,requests with an empty key are not limited
+	KeyFunc func(ctx *Context) string `json:"-"`
+	//Store limiter store,default the shared memory store
+	Store LimiterStore `json:"-"`
+}
+
+//Limit the limit passed to LimiterStore
+type Limit struct {
+	Algorithm string
+	Limit     int
+	Burst     int
+	Period    time.Duration
+}
+
+//LimitResult the result of LimiterStore.Take
+type LimitResult struct {
+	//Allowed the request is allowed
+	Allowed bool
+	//Remaining remaining requests
+	Remaining int
+	//Reset time until the limit is fully reset
+	Reset time.Duration
+	//RetryAfter time until the next request is allowed,if not allowed
+	RetryAfter time.Duration
+}
+
+//LimiterStore keeps the limiter state,
+//implement it with a shared backend(such as redis) to limit across instances
+type LimiterStore interface {
+	//Take consume one request of the key
+	Take(key string, limit *Limit, now time.Time) (LimitResult, error)
+}
+
+//KeyByIP limit by Context.ClientIP
+func KeyByIP(ctx *Context) string {
+	return ctx.ClientIP()
+}
+
+//KeyByUser limit by the authenticated user(Context.User),falls back to the client ip
+func KeyByUser(ctx *Context) string {
+	if u := ctx.User(); u != nil {
+		return "user:" + fmt.Sprint(u)
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+//KeyByHeader limit by the request header,requests without the header are not limited
+func KeyByHeader(name string) func(ctx *Context) string {
+	return func(ctx *Context) string {
+		return ctx.Request.Header.Get(name)
+	}
+}
+
+var (
+	limiterSeq         int64
+	defaultLimiterOnce sync.Once
+	defaultLimiter     LimiterStore
+)
+
+//defaultLimiterStore returns the shared memory store
+func defaultLimiterStore() LimiterStore {
+	defaultLimiterOnce.Do(func() {
+		defaultLimiter = NewMemoryLimiterStore()
+	})
+	return defaultLimiter
+}
+
+//RateLimit returns the rate limit middleware,
+//it sets X-RateLimit-Limit,X-RateLimit-Remaining and X-RateLimit-Reset
+//and replies SerRateLimitError with 429 and Retry-After if the limit is exceeded,
+//every RateLimit has its own counters,use it on a group to share them between the routes
+//	bast.Post("/login", login).Use(bast.RateLimit(&bast.RateLimitConf{Limit: 5, Period: 60}))
+func RateLimit(conf *RateLimitConf) Middleware {
+	prefix := "rl" + strconv.FormatInt(atomic.AddInt64(&limiterSeq, 1), 10) + ":"
+	return func(ctx *Context, next func(ctx *Context)) {
+		rateLimit(ctx, next, prefix, conf)
+	}
+}
+
+//RateLimitPolicy returns the rate limit middleware of the named policy of AppConf.RateLimits,
+//the policy is read from the config on the first request and updated by ReloadConf,
+//the request is not limited if the policy doesn't exist
+//	bast.Post("/sms/send", sendSMS).Use(bast.RateLimitPolicy("sms"))
+func RateLimitPolicy(name string) Middleware {
+	prefix := "policy:" + name + ":"
+	p := &ratePolicy{name: name}
+	OnConfChange(func(old, new *AppConf) {
+		p.set(new)
+	})
+	return func(ctx *Context, next func(ctx *Context)) {
+		rateLimit(ctx, next, prefix, p.get())
+	}
+}
+
+//ratePolicy the cached policy of RateLimitPolicy
+type ratePolicy struct {
+	name string
+	once sync.Once
+	mu   sync.RWMutex
+	conf *RateLimitConf
+}
+
+//get returns the policy,it's read from Conf() once
+func (p *ratePolicy) get() *RateLimitConf {
+	p.once.Do(func() {
+		if c := Conf(); c != nil {
+			p.set(c)
+		}
+	})
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.conf
+}
+
+//set update the policy from the config
+func (p *ratePolicy) set(c *AppConf) {
+	p.mu.Lock()
+	p.conf = c.RateLimits[p.name]
+	p.mu.Unlock()
+}
+
+func rateLimit(ctx *Context, next func(ctx *Context), prefix string, conf *RateLimitConf) {
+	if conf == nil || conf.Limit <= 0 {
+		next(ctx)
+		return
+	}
+	key := limitKey(ctx, conf)
+	if key == "" {
+		next(ctx)
+		return
+	}
+	limit := conf.limit()
+	store := conf.Store
+	if store == nil {
+		store = defaultLimiterStore()
+	}
+	res, err := store.Take(prefix+key, limit, time.Now())
+	if err != nil {
+		//fail open,the store is unavailable
+		logs.Error("rate limit store error=" + err.Error())
+		next(ctx)
+		return
+	}
+	h := ctx.ResponseWriter.Header()
+	max := limit.Limit
+	if limit.Algorithm == TokenBucket {
+		max = limit.Burst
+	}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(max))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+		logs.Info("rate limited,key=" + prefix + key + ",uri=" + ctx.Request.RequestURI)
+		ctx.FailResultWithStatus(http.StatusTooManyRequests, "请求过于频繁,请稍后重试", SerRateLimitError)
+		return
+	}
+	next(ctx)
+}
+
+//limitKey returns the key of the request
+func limitKey(ctx *Context, conf *RateLimitConf) string {
+	if conf.KeyFunc != nil {
+		return conf.KeyFunc(ctx)
+	}
+	switch k := conf.Key; {
+	case k == "user":
+		return KeyByUser(ctx)
+	case len(k) > 7 && k[:7] == "header:":
+		return KeyByHeader(k[7:])(ctx)
+	default:
+		return KeyByIP(ctx)
+	}
+}
+
+//limit returns the limit with defaults
+func (conf *RateLimitConf) limit() *Limit {
+	l := &Limit{Algorithm: conf.Algorithm, Limit: conf.Limit, Burst: conf.Burst, Period: time.Duration(conf.Period) * time.Second}
+	if l.Algorithm != SlidingWindow {
+		l.Algorithm = TokenBucket
+	}
+	if l.Period <= 0 {
+		l.Period = time.Second
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.Limit
+	}
+	return l
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+//MemoryLimiterStore in-memory LimiterStore,the state is per process
+type MemoryLimiterStore struct {
+	mu        sync.Mutex
+	entries   map[string]*limitEntry
+	lastSweep time.Time
+}
+
+type limitEntry struct {
+	//token bucket
+	tokens float64
+	last   time.Time
+	//sliding window
+	start     time.Time
+	prev, cur int
+	expires   time.Time
+}
+
+//NewMemoryLimiterStore create the in-memory store
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{entries: make(map[string]*limitEntry), lastSweep: time.Now()}
+}
+
+//Take consume one request of the key
+func (s *MemoryLimiterStore) Take(key string, limit *Limit, now time.Time) (LimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	e, ok := s.entries[key]
+	if !ok {
+		e = &limitEntry{tokens: float64(limit.Burst), last: now, start: now.Truncate(limit.Period)}
+		s.entries[key] = e
+	}
+	if limit.Algorithm == SlidingWindow {
+		return e.window(limit, now), nil
+	}
+	return e.bucket(limit, now), nil
+}
+
+//bucket token bucket
+func (e *limitEntry) bucket(limit *Limit, now time.Time) LimitResult {
+	rate := float64(limit.Limit) / limit.Period.Seconds()
+	capacity := float64(limit.Burst)
+	if elapsed := now.Sub(e.last).Seconds(); elapsed > 0 {
+		e.tokens = math.Min(capacity, e.tokens+elapsed*rate)
+		e.last = now
+	}
+	res := LimitResult{}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((capacity - e.tokens) / rate * float64(time.Second))
+	e.expires = now.Add(res.Reset)
+	return res
+}
+
+//window weighted sliding window counter
+func (e *limitEntry) window(limit *Limit, now time.Time) LimitResult {
+	start := now.Truncate(limit.Period)
+	if start != e.start {
+		if start.Sub(e.start) == limit.Period {
+			e.prev = e.cur
+		} else {
+			e.prev = 0
+		}
+		e.cur = 0
+		e.start = start
+	}
+	end := start.Add(limit.Period)
+	f := float64(now.Sub(start)) / float64(limit.Period)
+	count := float64(e.prev)*(1-f) + float64(e.cur)
+	res := LimitResult{Reset: end.Sub(now)}
+	if count+1 <= float64(limit.Limit) {
+		e.cur++
+		count++
+		res.Allowed = true
+	} else if e.cur >= limit.Limit || e.prev == 0 {
+		res.RetryAfter = end.Sub(now)
+	} else {
+		//the weight of prev has to drop until a request fits
+		need := 1 - float64(limit.Limit-1-e.cur)/float64(e.prev)
+		res.RetryAfter = time.Duration((need - f) * float64(limit.Period))
+	}
+	res.Remaining = limit.Limit - int(math.Ceil(count))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	e.expires = end.Add(limit.Period)
+	return res
+}
+
+//sweep remove the idle entries every minute
+func (s *MemoryLimiterStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+//limitGet send a GET request from ip,returns the status and X-RateLimit-Remaining
+func limitGet(t *testing.T, url, ip string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	//the test client is a trusted loopback proxy
+	req.Header.Set("X-Real-IP", ip)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res, res.Header.Get("X-RateLimit-Remaining")
+}
+
+//setTestLimiterStore replace the default limiter store with an empty one,
+//the policy counters are shared by name,it's restored after the test
+func setTestLimiterStore(t *testing.T) {
+	old := defaultLimiterStore()
+	defaultLimiter = NewMemoryLimiterStore()
+	t.Cleanup(func() { defaultLimiter = old })
+}
+
+func TestRateLimitPolicy(t *testing.T) {
+	setTestLimiterStore(t)
+	setTestConf(t, &AppConf{Key: "ratelimit", RateLimits: map[string]*RateLimitConf{
+		"sms":    {Limit: 2, Period: 60},
+		"window": {Algorithm: SlidingWindow, Limit: 1, Period: 60},
+	}})
+	ok := func(ctx *Context) { ctx.JSON("ok") }
+	urls := map[string]string{}
+	for _, name := range []string{"sms", "window", "none"} {
+		urls[name] = serveRoute(t, newTestRoute(ok, RateLimitPolicy(name))).URL
+	}
+
+	tests := []struct {
+		policy, ip string
+		status     int
+		remaining  string
+	}{
+		{"sms", "10.0.0.1", http.StatusOK, "1"},
+		{"sms", "10.0.0.1", http.StatusOK, "0"},
+		{"sms", "10.0.0.1", http.StatusTooManyRequests, "0"},
+		{"sms", "10.0.0.2", http.StatusOK, "1"},
+		{"window", "10.0.0.1", http.StatusOK, "0"},
+		{"window", "10.0.0.1", http.StatusTooManyRequests, "0"},
+		{"none", "10.0.0.1", http.StatusOK, ""},
+		{"none", "10.0.0.1", http.StatusOK, ""},
+	}
+	for i, tt := range tests {
+		res, remaining := limitGet(t, urls[tt.policy], tt.ip)
+		if res.StatusCode != tt.status {
+			t.Errorf("%d %s: status=%d,want %d", i, tt.policy, res.StatusCode, tt.status)
+		}
+		if remaining != tt.remaining {
+			t.Errorf("%d %s: remaining=%q,want %q", i, tt.policy, remaining, tt.remaining)
+		}
+		if tt.status == http.StatusTooManyRequests && res.Header.Get("Retry-After") == "" {
+			t.Errorf("%d %s: no Retry-After", i, tt.policy)
+		}
+	}
+}
+
+func TestRateLimitPolicyReload(t *testing.T) {
+	setTestLimiterStore(t)
+	path := setTestConfFile(t, "config.conf", `[{"key":"ratelimit","rateLimits":{"sms":{"limit":1,"period":60}}}]`)
+	url := serveRoute(t, newTestRoute(func(ctx *Context) { ctx.JSON("ok") }, RateLimitPolicy("sms"))).URL
+	if _, remaining := limitGet(t, url, "10.0.1.1"); remaining != "0" {
+		t.Fatalf("remaining=%q,want 0", remaining)
+	}
+	if err := os.WriteFile(path, []byte(`[{"key":"ratelimit","rateLimits":{"sms":{"limit":3,"period":60}}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//the policy is cached until the config is reloaded
+	if _, remaining := limitGet(t, url, "10.0.1.2"); remaining != "0" {
+		t.Fatalf("remaining=%q before reload,want 0", remaining)
+	}
+	if err := ReloadConf(); err != nil {
+		t.Fatal(err)
+	}
+	if _, remaining := limitGet(t, url, "10.0.1.3"); remaining != "2" {
+		t.Fatalf("remaining=%q after reload,want 2", remaining)
+	}
+}
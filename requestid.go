@@ -0,0 +1,51 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"github.com/aixiaoxiang/bast/ids"
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//RequestIDHeader the request id header
+const RequestIDHeader = "X-Request-ID"
+
+//RequestID returns the middleware reading the X-Request-ID header or creating a new id,
+//the id is echoed in the response,attached to the Context log methods and
+//forwarded by HTTPClientProxy.Dos when the request is made with the Context
+//	bast.Use(bast.RequestID())
+//	req, _ := http.NewRequest("GET", url, nil)
+//	bast.HTTP.Dos(req.WithContext(ctx))
+func RequestID() Middleware {
+	return func(ctx *Context, next func(ctx *Context)) {
+		id := ctx.Request.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = ids.IDStr()
+		}
+		ctx.ResponseWriter.Header().Set(RequestIDHeader, id)
+		ctx.WithValue(logs.RequestIDKey, id)
+		next(ctx)
+	}
+}
+
+//validRequestID returns true if the client id is short and safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+//RequestID 获取当前请求的ID(需启用RequestID中间件),不存在返回空
+func (c *Context) RequestID() string {
+	if c.Request == nil {
+		return ""
+	}
+	return logs.RequestID(c.Request.Context())
+}
@@ -0,0 +1,124 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+func TestRequestID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	setTestLog(t, &logs.LogConf{OutPath: path})
+	//upstream echoes the forwarded id
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(RequestIDHeader)))
+	}))
+	defer upstream.Close()
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		if ctx.In != ctx.Request {
+			t.Error("ctx.In doesn't carry the request id")
+		}
+		ctx.I("handled")
+		req, _ := http.NewRequest("GET", upstream.URL, nil)
+		res, err := HTTP.Dos(req.WithContext(ctx.context()))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		forwarded, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		ctx.SayStr(ctx.RequestID() + "|" + string(forwarded))
+	}, RequestID()))
+
+	tests := []struct {
+		name, id string
+		kept     bool
+	}{
+		{"client id", "req-1.a_b:c", true},
+		{"no id", "", false},
+		{"unsafe id", "req 1;<x>", false},
+		{"long id", strings.Repeat("a", 129), false},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", srv.URL+"/test", nil)
+		if tt.id != "" {
+			req.Header.Set(RequestIDHeader, tt.id)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		id := res.Header.Get(RequestIDHeader)
+		if id == "" || (id == tt.id) != tt.kept || seen[id] {
+			t.Errorf("%s: id=%q", tt.name, id)
+		}
+		seen[id] = true
+		if string(body) != id+"|"+id {
+			t.Errorf("%s: id=%q,body=%q", tt.name, id, body)
+		}
+	}
+
+	logs.Sync()
+	data, _ := ioutil.ReadFile(path)
+	logged := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.Contains(line, `"msg":"handled"`) {
+			continue
+		}
+		logged++
+		found := false
+		for id := range seen {
+			found = found || strings.Contains(line, `"requestId":"`+id+`"`)
+		}
+		if !found {
+			t.Errorf("no request id:%s", line)
+		}
+	}
+	if logged != len(tests) {
+		t.Errorf("logged=%d:\n%s", logged, data)
+	}
+}
+
+func TestRequestIDOutbound(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(RequestIDHeader)))
+	}))
+	defer upstream.Close()
+	tests := []struct {
+		name, ctxID, header, want string
+	}{
+		{"no context id", "", "", ""},
+		{"context id", "req-1", "", "req-1"},
+		{"explicit header", "req-1", "req-2", "req-2"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", upstream.URL, nil)
+		if tt.ctxID != "" {
+			ctx := &Context{Request: req}
+			ctx.WithValue(logs.RequestIDKey, tt.ctxID)
+			req = ctx.Request
+		}
+		if tt.header != "" {
+			req.Header.Set(RequestIDHeader, tt.header)
+		}
+		res, err := HTTP.Dos(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != tt.want {
+			t.Errorf("%s: forwarded=%q", tt.name, body)
+		}
+	}
+}
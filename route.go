@@ -0,0 +1,267 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Route is a registered request route
+type Route struct {
+	Method       string
+	Pattern      string
+	handler      func(ctx *Context)
+	middlewares  []Middleware
+	static       bool
+	maxBodyBytes int64
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	timeout      time.Duration
+	group        *RouteGroup
+	permissions  []string
+}
+
+//RouteInfo is route introspection info
+type RouteInfo struct {
+	Method       string        `json:"method"`
+	Pattern      string        `json:"pattern"`
+	MaxBodyBytes int64         `json:"maxBodyBytes"`
+	Timeout      time.Duration `json:"timeout"`
+	Permissions  []string      `json:"permissions"`
+}
+
+//Routes returns all registered routes
+func Routes() []RouteInfo {
+	rs := make([]RouteInfo, 0, len(app.routes))
+	for _, r := range app.routes {
+		rs = append(rs, RouteInfo{
+			Method:       r.Method,
+			Pattern:      r.Pattern,
+			MaxBodyBytes: r.bodyLimit(),
+			Timeout:      r.handlerTimeout(),
+			Permissions:  r.requiredPermissions(),
+		})
+	}
+	return rs
+}
+
+//MaxBodyBytes set the max request body bytes of the route,
+//overrides the app setting,-1 means unlimited
+func (r *Route) MaxBodyBytes(n int64) *Route {
+	r.maxBodyBytes = n
+	return r
+}
+
+//ReadTimeout set the connection read deadline of the route(go1.20+)
+func (r *Route) ReadTimeout(d time.Duration) *Route {
+	r.readTimeout = d
+	return r
+}
+
+//WriteTimeout set the connection write deadline of the route(go1.20+)
+func (r *Route) WriteTimeout(d time.Duration) *Route {
+	r.writeTimeout = d
+	return r
+}
+
+//Timeout set the handler deadline of the route,overrides the app setting,
+//-1 means no deadline
+func (r *Route) Timeout(d time.Duration) *Route {
+	r.timeout = d
+	return r
+}
+
+//bodyLimit returns the effective max body bytes,0 means unlimited
+func (r *Route) bodyLimit() int64 {
+	n := r.maxBodyBytes
+	if n == 0 {
+		n = app.maxBody()
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+//handlerTimeout returns the effective handler deadline,0 means no deadline
+func (r *Route) handlerTimeout() time.Duration {
+	d := r.timeout
+	if d == 0 {
+		d = app.handlerTimeout()
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+//serve handle the request of the route
+func (r *Route) serve(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	start := time.Now()
+	cors(w, req)
+	if req.Method == "OPTIONS" {
+		r.logAccessStatus(req, http.StatusOK, start)
+		return
+	}
+	if r.Pattern == "/" && req.URL.Path != r.Pattern {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, http.StatusText(http.StatusNotFound))
+		r.logAccessStatus(req, http.StatusNotFound, start)
+		return
+	}
+	if req.Method != r.Method {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprint(w, http.StatusText(http.StatusMethodNotAllowed))
+		r.logAccessStatus(req, http.StatusMethodNotAllowed, start)
+		return
+	}
+	if r.handler == nil {
+		return
+	}
+	if n := r.bodyLimit(); n > 0 {
+		if req.ContentLength > n {
+			writeFail(w, http.StatusRequestEntityTooLarge, "请求体过大", SerRequestTooLargeError)
+			r.logAccessStatus(req, http.StatusRequestEntityTooLarge, start)
+			return
+		}
+	}
+	setDeadline(w, r.readTimeout, r.writeTimeout)
+	//the Context isn't reused,it may be held as a context.Context after the handler returns
+	ctx := &Context{}
+	ctx.route = r
+	ctx.Params = ps
+	if n := r.bodyLimit(); n > 0 {
+		req.Body = http.MaxBytesReader(&ctx.writer, req.Body, n)
+	}
+	timeout := r.handlerTimeout()
+	if timeout <= 0 {
+		ctx.init(w, req)
+		r.run(ctx)
+		r.logAccess(ctx, start)
+		return
+	}
+	c, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	ctx.init(w, req.WithContext(c))
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+		r.logAccess(ctx, start)
+	case <-c.Done():
+		if c.Err() == context.DeadlineExceeded {
+			ctx.writer.timeout(func(rw http.ResponseWriter) {
+				writeFail(rw, http.StatusServiceUnavailable, "请求超时", SerTimeoutError)
+			})
+		} else {
+			ctx.writer.timeout(nil)
+		}
+		//log the access after the handler returns
+		go func() {
+			<-done
+			r.logAccess(ctx, start)
+		}()
+	}
+}
+
+//run call Before,handler and After with panic recovery
+func (r *Route) run(ctx *Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			req := ctx.Request
+			errMsg := fmt.Sprintf("%s", err)
+			logs.Error(req.Method+":"+req.RequestURI+"->error="+errMsg, ctx.logFields(nil)...)
+			ctx.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(ctx.ResponseWriter, http.StatusText(http.StatusInternalServerError))
+		}
+		ctx.writer.finish()
+	}()
+	next(r.chain(), 0, r.final)(ctx)
+}
+
+//final call Before,handler and After,
+//static file routes skip Before and After
+func (r *Route) final(ctx *Context) {
+	if !r.authorize(ctx) {
+		return
+	}
+	if r.static {
+		r.handler(ctx)
+		return
+	}
+	if app.Before != nil {
+		if app.Before(ctx) != nil {
+			return
+		}
+	}
+	r.handler(ctx)
+	if app.After != nil {
+		app.After(ctx)
+	}
+}
+
+//writeFail write the standard fail envelope with http status code
+func writeFail(w http.ResponseWriter, statusCode int, msg string, errCode int) {
+	data, _ := json.Marshal(&Msgs{Code: errCode, Msg: msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+//isBodyTooLarge returns true if err is caused by the max body bytes limit
+func isBodyTooLarge(err error) bool {
+	var e *http.MaxBytesError
+	return errors.As(err, &e)
+}
+
+//cors set the CORS headers if the origin is allowed
+func cors(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin == "" || !allowOrigin(origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, Authorization,Access-Control-Allow-Origin,Content-Length,Content-Type,BaseUrl")
+	w.Header().Set("Access-Control-Max-Age", "1728000")
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Add("Vary", "Origin")
+}
+
+//allowOrigin check the origin against app AllowOrigins,
+//empty AllowOrigins allows any origin,"*.example.com" matches the subdomains
+func allowOrigin(origin string) bool {
+	origins := app.origins()
+	if len(origins) == 0 {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	host := origin
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	for _, o := range origins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*", o == origin, o == host:
+			return true
+		case strings.HasPrefix(o, "*."):
+			if strings.HasSuffix(host, o[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
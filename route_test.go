@@ -0,0 +1,83 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	fail := func(ctx *Context, err error) {
+		if err != nil {
+			ctx.FailResult("bad request", SerError, err)
+			return
+		}
+		ctx.JSON("ok")
+	}
+	srv := setTestRouter(t)
+	Post("/limit-test/json", func(ctx *Context) {
+		var v interface{}
+		fail(ctx, ctx.JSONObj(&v))
+	}).MaxBodyBytes(16)
+	Post("/limit-test/xml", func(ctx *Context) {
+		var v struct{ A string }
+		fail(ctx, ctx.XMLObj(&v))
+	}).MaxBodyBytes(16)
+	Post("/limit-test/raw", func(ctx *Context) {
+		ctx.GetRawStr()
+		ctx.JSON("ok")
+	}).MaxBodyBytes(16)
+	Post("/limit-test/upload", func(ctx *Context) {
+		_, err := FileHandleUpload(ctx, t.TempDir(), false)
+		fail(ctx, err)
+	}).MaxBodyBytes(64)
+
+	big := `{"a":"` + strings.Repeat("x", 64) + `"}`
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("f", "a.txt")
+	fw.Write(bytes.Repeat([]byte("x"), 256))
+	mw.Close()
+	tests := []struct {
+		name, path, body, ctype string
+		chunked                 bool
+		status                  int
+	}{
+		{"json declared", "/limit-test/json", big, "", false, http.StatusRequestEntityTooLarge},
+		{"json chunked", "/limit-test/json", big, "", true, http.StatusRequestEntityTooLarge},
+		{"json small", "/limit-test/json", `{"a":1}`, "", true, http.StatusOK},
+		{"xml chunked", "/limit-test/xml", "<x><A>" + strings.Repeat("x", 64) + "</A></x>", "", true, http.StatusRequestEntityTooLarge},
+		{"raw chunked", "/limit-test/raw", big, "", true, http.StatusRequestEntityTooLarge},
+		{"upload chunked", "/limit-test/upload", form.String(), mw.FormDataContentType(), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		var body io.Reader = strings.NewReader(tt.body)
+		if tt.chunked {
+			//hide the length so the body is sent chunked
+			body = io.MultiReader(body)
+		}
+		req, _ := http.NewRequest("POST", srv.URL+tt.path, body)
+		if tt.ctype != "" {
+			req.Header.Set("Content-Type", tt.ctype)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &Msgs{}
+		err = json.NewDecoder(res.Body).Decode(msg)
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: status=%d,want %d", tt.name, res.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusRequestEntityTooLarge && (err != nil || msg.Code != SerRequestTooLargeError) {
+			t.Errorf("%s: body=%+v,err=%v", tt.name, msg, err)
+		}
+	}
+}
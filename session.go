@@ -0,0 +1,473 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+const (
+	//SessionUserKey the session key of the signed in user
+	SessionUserKey = "user"
+	//sessionCtxKey the request store key of the loaded session
+	sessionCtxKey = "bast.session"
+)
+
+var (
+	//ErrSessionExpired the session has expired or been tampered
+	ErrSessionExpired = errors.New("session expired")
+	//ErrSessionHeaderWritten the cookie can't be set after the response header is written
+	ErrSessionHeaderWritten = errors.New("session cookie can't be set after the response header is written")
+)
+
+//SessionConf session config
+type SessionConf struct {
+	//Name cookie name,default "bast_session"
+	Name string `json:"name"`
+	//TTL session lifetime(seconds),default 86400
+	TTL int `json:"ttl"`
+	//Domain cookie domain
+	Domain string `json:"domain"`
+	//Path cookie path,default "/"
+	Path string `json:"path"`
+	//SameSite lax|strict|none,default lax
+	SameSite string `json:"sameSite"`
+	//Secure always set the Secure flag,otherwise it's set on https requests only
+	Secure bool `json:"secure"`
+	//Store memory|cookie,default memory
+	Store string `json:"store"`
+	//Secret the key of the cookie store
+	Secret string `json:"secret"`
+}
+
+//SessionStore persist the session,see NewMemoryStore and NewCookieStore
+type SessionStore interface {
+	//Load returns the session of the request,a new session if not exist or expired
+	Load(ctx *Context, conf *SessionConf) (*Session, error)
+	//Save persist the session and set the cookie
+	Save(ctx *Context, s *Session) error
+	//Destroy remove the session and expire the cookie
+	Destroy(ctx *Context, s *Session) error
+}
+
+//Session is user session
+type Session struct {
+	//ID session id,empty for the cookie store
+	ID string
+	//Values session values
+	Values map[string]interface{}
+	//IsNew the session is just created
+	IsNew bool
+	//Expires expiration time
+	Expires time.Time
+	conf    *SessionConf
+	store   SessionStore
+	ctx     *Context
+	mu      sync.RWMutex
+}
+
+//SessionInit set the session config and store,
+//the store is created by conf.Store if it's nil
+func SessionInit(conf *SessionConf, store SessionStore) {
+	app.sessionConf = conf
+	app.sessionStore = store
+}
+
+//sessionConf returns the session config with defaults
+func sessionConf() *SessionConf {
+	c := SessionConf{}
+	if app.sessionConf != nil {
+		c = *app.sessionConf
+	}
+	if c.Name == "" {
+		c.Name = "bast_session"
+	}
+	if c.TTL <= 0 {
+		c.TTL = 86400
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	return &c
+}
+
+//sessionStore returns the session store
+func sessionStore(conf *SessionConf) SessionStore {
+	app.sessionMu.Lock()
+	defer app.sessionMu.Unlock()
+	if app.sessionStore == nil {
+		if strings.ToLower(conf.Store) == "cookie" {
+			app.sessionStore = NewCookieStore(conf.Secret)
+		} else {
+			app.sessionStore = NewMemoryStore()
+		}
+	}
+	return app.sessionStore
+}
+
+//Session 获取当前请求的会话,不存在则创建
+func (c *Context) Session() *Session {
+	if v, ok := c.Get(sessionCtxKey); ok {
+		return v.(*Session)
+	}
+	conf := sessionConf()
+	store := sessionStore(conf)
+	s, err := store.Load(c, conf)
+	if err != nil || s == nil {
+		s = newSession(conf)
+	}
+	s.conf = conf
+	s.store = store
+	s.ctx = c
+	c.Set(sessionCtxKey, s)
+	return s
+}
+
+//SignIn 用户登录,重新生成会话(防止会话固定攻击)并保存用户信息
+//param:
+//	user 用户信息(如用户ID)
+func (c *Context) SignIn(user interface{}) error {
+	s := c.Session()
+	if err := s.Renew(); err != nil {
+		return err
+	}
+	if err := s.Set(SessionUserKey, user); err != nil {
+		return err
+	}
+	refreshCSRF(c)
+	return nil
+}
+
+//SignOut 用户登出,销毁当前会话
+func (c *Context) SignOut() error {
+	err := c.Session().Destroy()
+	refreshCSRF(c)
+	return err
+}
+
+//SessionUser 获取当前登录的用户信息,未登录返回nil
+func (c *Context) SessionUser() interface{} {
+	return c.Session().Get(SessionUserKey)
+}
+
+//newSession create a new session
+func newSession(conf *SessionConf) *Session {
+	return &Session{
+		Values:  make(map[string]interface{}),
+		IsNew:   true,
+		Expires: time.Now().Add(time.Duration(conf.TTL) * time.Second),
+		conf:    conf,
+	}
+}
+
+//Get returns the session value
+func (s *Session) Get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Values[key]
+}
+
+//Set set the session value and save the session,
+//it must be called before the response is written with the cookie store
+func (s *Session) Set(key string, value interface{}) error {
+	s.mu.Lock()
+	s.Values[key] = value
+	s.mu.Unlock()
+	return s.Save()
+}
+
+//Delete delete the session value and save the session
+func (s *Session) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.Values, key)
+	s.mu.Unlock()
+	return s.Save()
+}
+
+//Clear delete all session values and save the session
+func (s *Session) Clear() error {
+	s.mu.Lock()
+	s.Values = make(map[string]interface{})
+	s.mu.Unlock()
+	return s.Save()
+}
+
+//Save persist the session and refresh the expiration
+func (s *Session) Save() error {
+	s.Expires = time.Now().Add(time.Duration(s.conf.TTL) * time.Second)
+	return s.store.Save(s.ctx, s)
+}
+
+//Renew regenerate the session id and keep the values
+func (s *Session) Renew() error {
+	if !s.IsNew {
+		old := &Session{ID: s.ID, conf: s.conf}
+		if err := s.store.Destroy(s.ctx, old); err != nil {
+			return err
+		}
+	}
+	s.ID = ""
+	s.IsNew = true
+	return s.Save()
+}
+
+//Destroy remove the session and expire the cookie
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	s.Values = make(map[string]interface{})
+	s.mu.Unlock()
+	err := s.store.Destroy(s.ctx, s)
+	s.ID = ""
+	s.IsNew = true
+	return err
+}
+
+//setSessionCookie set the session cookie,maxAge < 0 deletes it
+func setSessionCookie(ctx *Context, conf *SessionConf, value string, maxAge int) error {
+	if written(ctx.ResponseWriter) {
+		return ErrSessionHeaderWritten
+	}
+	ck := &http.Cookie{
+		Name:     conf.Name,
+		Value:    value,
+		Path:     conf.Path,
+		Domain:   conf.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+	}
+	switch strings.ToLower(conf.SameSite) {
+	case "strict":
+		ck.SameSite = http.SameSiteStrictMode
+	case "none":
+		ck.SameSite = http.SameSiteNoneMode
+	default:
+		ck.SameSite = http.SameSiteLaxMode
+	}
+	if maxAge < 0 {
+		ck.Expires = time.Unix(1, 0)
+	}
+	if conf.Secure {
+		ctx.SetCookie(ck)
+	} else {
+		ctx.SetCookie(ck, CookieInsecure)
+	}
+	return nil
+}
+
+//newSessionID returns a random session id
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*********************************
+* memory store
+*********************************/
+
+//MemoryStore keeps the sessions in memory,the cookie only holds the session id
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]*memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+//NewMemoryStore create the in-memory session store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*memorySession), lastSweep: time.Now()}
+}
+
+//Load see SessionStore Load
+func (m *MemoryStore) Load(ctx *Context, conf *SessionConf) (*Session, error) {
+	id := ctx.Cookie(conf.Name)
+	if id == "" {
+		return newSession(conf), nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms, ok := m.sessions[id]
+	if !ok || time.Now().After(ms.expires) {
+		delete(m.sessions, id)
+		return newSession(conf), nil
+	}
+	values := make(map[string]interface{}, len(ms.values))
+	for k, v := range ms.values {
+		values[k] = v
+	}
+	return &Session{ID: id, Values: values, Expires: ms.expires, conf: conf}, nil
+}
+
+//Save see SessionStore Save
+func (m *MemoryStore) Save(ctx *Context, s *Session) error {
+	if s.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		s.ID = id
+	}
+	if s.IsNew {
+		if err := setSessionCookie(ctx, s.conf, s.ID, s.conf.TTL); err != nil {
+			return err
+		}
+		s.IsNew = false
+	} else {
+		//refresh the cookie expiration if possible
+		setSessionCookie(ctx, s.conf, s.ID, s.conf.TTL)
+	}
+	s.mu.RLock()
+	values := make(map[string]interface{}, len(s.Values))
+	for k, v := range s.Values {
+		values[k] = v
+	}
+	s.mu.RUnlock()
+	m.mu.Lock()
+	m.sessions[s.ID] = &memorySession{values: values, expires: s.Expires}
+	m.sweep()
+	m.mu.Unlock()
+	return nil
+}
+
+//Destroy see SessionStore Destroy
+func (m *MemoryStore) Destroy(ctx *Context, s *Session) error {
+	if s.ID != "" {
+		m.mu.Lock()
+		delete(m.sessions, s.ID)
+		m.mu.Unlock()
+	}
+	return setSessionCookie(ctx, s.conf, "", -1)
+}
+
+//sweep remove the expired sessions every minute,must hold the lock
+func (m *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for id, ms := range m.sessions {
+		if now.After(ms.expires) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+/*********************************
+* cookie store
+*********************************/
+
+//CookieStore keeps the session values in the cookie,
+//encrypted and signed with AES-GCM,values are gob encoded so they keep the types,
+//register the custom types of the values with gob.Register
+type CookieStore struct {
+	aead cipher.AEAD
+}
+
+type cookieSession struct {
+	Values  map[string]interface{}
+	Expires int64
+}
+
+//NewCookieStore create the cookie session store,the key is derived from secret,
+//a random key is used if secret is empty,so the sessions don't survive restarts
+func NewCookieStore(secret string) *CookieStore {
+	if secret == "" {
+		logs.Error("session cookie store secret is empty,use a random key")
+		b := make([]byte, 32)
+		io.ReadFull(rand.Reader, b)
+		secret = string(b)
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	return &CookieStore{aead: aead}
+}
+
+//Load see SessionStore Load
+func (cs *CookieStore) Load(ctx *Context, conf *SessionConf) (*Session, error) {
+	v := ctx.Cookie(conf.Name)
+	if v == "" {
+		return newSession(conf), nil
+	}
+	data, err := cs.decrypt(v)
+	if err != nil {
+		return newSession(conf), nil
+	}
+	c := &cookieSession{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(c); err != nil || time.Now().Unix() > c.Expires {
+		return newSession(conf), nil
+	}
+	if c.Values == nil {
+		c.Values = make(map[string]interface{})
+	}
+	return &Session{Values: c.Values, Expires: time.Unix(c.Expires, 0), conf: conf}, nil
+}
+
+//Save see SessionStore Save
+func (cs *CookieStore) Save(ctx *Context, s *Session) error {
+	var buf bytes.Buffer
+	s.mu.RLock()
+	err := gob.NewEncoder(&buf).Encode(&cookieSession{Values: s.Values, Expires: s.Expires.Unix()})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	v, err := cs.encrypt(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if len(v) > 4000 {
+		return errors.New("session cookie too large")
+	}
+	if err := setSessionCookie(ctx, s.conf, v, s.conf.TTL); err != nil {
+		return err
+	}
+	s.IsNew = false
+	return nil
+}
+
+//Destroy see SessionStore Destroy
+func (cs *CookieStore) Destroy(ctx *Context, s *Session) error {
+	return setSessionCookie(ctx, s.conf, "", -1)
+}
+
+func (cs *CookieStore) encrypt(data []byte) (string, error) {
+	nonce := make([]byte, cs.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cs.aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+func (cs *CookieStore) decrypt(v string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	n := cs.aead.NonceSize()
+	if len(data) < n {
+		return nil, ErrSessionExpired
+	}
+	return cs.aead.Open(nil, data[:n], data[n:], nil)
+}
@@ -0,0 +1,139 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//sessionTestServer serve a route using the session,
+//?h=signin signs in the user 42,?h=set sets the values,?h=signout signs out,
+//the other requests reply the type and value of the user
+func sessionTestServer(t *testing.T, store SessionStore) string {
+	setTestSession(t, &SessionConf{Name: "sid"}, store)
+	r := newTestRoute(func(ctx *Context) {
+		switch ctx.GetString("h") {
+		case "signin":
+			if err := ctx.SignIn(42); err != nil {
+				t.Error(err)
+			}
+		case "set":
+			s := ctx.Session()
+			s.Set("n", int64(7))
+			s.Set("tags", []string{"a", "b"})
+		case "big":
+			err := ctx.Session().Set("big", strings.Repeat("x", 5000))
+			if _, ok := store.(*CookieStore); ok && err == nil {
+				t.Error("the too large cookie is saved")
+			}
+		case "signout":
+			ctx.SignOut()
+		}
+		u := ctx.SessionUser()
+		n, _ := ctx.Session().Get("n").(int64)
+		tags, _ := ctx.Session().Get("tags").([]string)
+		_, isInt := u.(int)
+		ctx.JSON(map[string]interface{}{"user": u, "int": isInt, "n": n, "tags": tags})
+	})
+	return serveRoute(t, r).URL + "/test"
+}
+
+//sessionGet returns the reply and the session cookie of the response
+func sessionGet(t *testing.T, url string, ck *http.Cookie) (map[string]interface{}, *http.Cookie) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if ck != nil {
+		req.AddCookie(ck)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	reply := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range res.Cookies() {
+		if c.Name == "sid" {
+			return reply.Data, c
+		}
+	}
+	return reply.Data, nil
+}
+
+func TestSession(t *testing.T) {
+	stores := map[string]SessionStore{"memory": NewMemoryStore(), "cookie": NewCookieStore("session-test")}
+	for name, store := range stores {
+		url := sessionTestServer(t, store)
+		data, ck := sessionGet(t, url+"?h=signin", nil)
+		if ck == nil || data["user"] != 42.0 {
+			t.Fatalf("%s: sign in reply=%v,cookie=%v", name, data, ck)
+		}
+		if !ck.HttpOnly || ck.Secure || ck.SameSite != http.SameSiteLaxMode {
+			t.Errorf("%s: cookie=%v", name, ck)
+		}
+		data, ck2 := sessionGet(t, url+"?h=set", ck)
+		if ck2 != nil {
+			ck = ck2
+		}
+		//the values keep the types
+		data, _ = sessionGet(t, url, ck)
+		if data["int"] != true || data["n"] != 7.0 || len(data["tags"].([]interface{})) != 2 {
+			t.Errorf("%s: reply=%v", name, data)
+		}
+		sessionGet(t, url+"?h=big", ck)
+		//a tampered or unknown cookie is a new session
+		data, _ = sessionGet(t, url, &http.Cookie{Name: "sid", Value: ck.Value[:len(ck.Value)-2] + "xx"})
+		if data["user"] != nil {
+			t.Errorf("%s: tampered cookie user=%v", name, data["user"])
+		}
+		data, out := sessionGet(t, url+"?h=signout", ck)
+		if data["user"] != nil || out == nil || out.MaxAge >= 0 {
+			t.Errorf("%s: sign out reply=%v,cookie=%v", name, data, out)
+		}
+		if name == "memory" {
+			//the destroyed session can't be used again
+			if data, _ = sessionGet(t, url, ck); data["user"] != nil {
+				t.Errorf("%s: destroyed session user=%v", name, data["user"])
+			}
+		}
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	tests := []struct {
+		name             string
+		https            bool
+		cookie           *http.Cookie
+		opts             []CookieOption
+		httpOnly, secure bool
+	}{
+		{"default", false, &http.Cookie{Name: "a", Value: "1"}, nil, true, true},
+		{"samesite set", false, &http.Cookie{Name: "a", Value: "1", SameSite: http.SameSiteStrictMode}, nil, true, true},
+		{"script", false, &http.Cookie{Name: "a", Value: "1"}, []CookieOption{CookieScript}, false, true},
+		{"insecure http", false, &http.Cookie{Name: "a", Value: "1"}, []CookieOption{CookieInsecure}, true, false},
+		{"insecure https", true, &http.Cookie{Name: "a", Value: "1"}, []CookieOption{CookieInsecure}, true, true},
+		{"insecure samesite none", false, &http.Cookie{Name: "a", Value: "1", SameSite: http.SameSiteNoneMode}, []CookieOption{CookieInsecure}, true, true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.https {
+			req = httptest.NewRequest("GET", "https://example.com/", nil)
+		}
+		ctx := &Context{}
+		ctx.init(w, req)
+		ctx.SetCookie(tt.cookie, tt.opts...)
+		ctx.writer.finish()
+		cs := w.Result().Cookies()
+		if len(cs) != 1 || cs[0].HttpOnly != tt.httpOnly || cs[0].Secure != tt.secure || cs[0].Path != "/" {
+			t.Errorf("%s: %v", tt.name, w.Header()["Set-Cookie"])
+		}
+	}
+}
@@ -0,0 +1,339 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+)
+
+//ErrHubClosed the hub has been closed
+var ErrHubClosed = errors.New("hub closed")
+
+//ErrSlowSubscriber the subscriber didn't keep up with the published events and was closed
+var ErrSlowSubscriber = errors.New("slow subscriber")
+
+//SSEvent is Server-Sent Event
+type SSEvent struct {
+	//ID event id,sent back by the client as Last-Event-ID when reconnecting
+	ID string
+	//Event event type,empty is "message"
+	Event string
+	//Data event data,string and []byte are sent as is,others are encoded as JSON
+	Data interface{}
+	//Retry client reconnection time(milliseconds)
+	Retry int
+}
+
+//SSEWriter Server-Sent Events writer
+type SSEWriter struct {
+	c           *Context
+	w           *bufio.Writer
+	mu          sync.Mutex
+	lastEventID string
+}
+
+//SSE 开启Server-Sent Events输出,设置相应的响应头并返回事件输出对象
+//注意：SSE路由请设置Timeout(-1),否则会被请求超时中断
+func (c *Context) SSE() (*SSEWriter, error) {
+	if _, ok := c.ResponseWriter.(http.Flusher); !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	h := c.ResponseWriter.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+	s := &SSEWriter{c: c, w: bufio.NewWriter(c.ResponseWriter), lastEventID: c.Request.Header.Get("Last-Event-ID")}
+	if s.lastEventID == "" {
+		//EventSource polyfills may not be able to set headers
+		s.lastEventID = c.Request.URL.Query().Get("lastEventId")
+	}
+	s.flush()
+	return s, nil
+}
+
+//LastEventID returns the Last-Event-ID of the reconnecting client
+func (s *SSEWriter) LastEventID() string {
+	return s.lastEventID
+}
+
+//Send write the event and flush
+func (s *SSEWriter) Send(e *SSEvent) error {
+	if e == nil {
+		return nil
+	}
+	data, err := sseData(e.Data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.c.context().Err(); err != nil {
+		return err
+	}
+	if e.ID != "" {
+		s.w.WriteString("id: " + sseLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		s.w.WriteString("event: " + sseLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		s.w.WriteString("retry: " + strconv.Itoa(e.Retry) + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		s.w.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	s.w.WriteString("\n")
+	return s.flush()
+}
+
+//Data write a message event with data
+func (s *SSEWriter) Data(data interface{}) error {
+	return s.Send(&SSEvent{Data: data})
+}
+
+//Comment write a comment line,used as keepalive
+func (s *SSEWriter) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.WriteString(": " + sseLine(text) + "\n\n")
+	return s.flush()
+}
+
+//flush flush the event to the client
+func (s *SSEWriter) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.c.ResponseWriter.(http.Flusher).Flush()
+	return nil
+}
+
+//sseData encode the event data
+func sseData(v interface{}) (string, error) {
+	switch d := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return d, nil
+	case []byte:
+		return string(d), nil
+	default:
+		data, err := json.Marshal(d)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+//sseLine remove line breaks of the field value
+func sseLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+//Hub fans out the published events to the subscribed SSE connections by topic,
+//the event ID is the hub sequence number,
+//it keeps the recent events of every topic to replay the ones after Last-Event-ID
+type Hub struct {
+	mu      sync.RWMutex
+	topics  map[string]*hubTopic
+	seq     int64
+	history int
+	closed  bool
+	done    chan struct{}
+	//Keepalive comment interval,0 means no keepalive
+	Keepalive time.Duration
+}
+
+type hubTopic struct {
+	subs   map[*hubSub]struct{}
+	recent []*hubEvent
+}
+
+//hubEvent the published copy of the event
+type hubEvent struct {
+	seq int64
+	e   *SSEvent
+}
+
+type hubSub struct {
+	ch chan *hubEvent
+	//slow is closed when the buffer is full,guarded by the hub lock
+	slow    chan struct{}
+	dropped bool
+}
+
+//NewHub create a Hub,history is the number of recent events kept per topic for replay,
+//the hub is closed when the server shuts down
+func NewHub(history int) *Hub {
+	h := &Hub{topics: make(map[string]*hubTopic), history: history, done: make(chan struct{}), Keepalive: 30 * time.Second}
+	app.Server.RegisterOnShutdown(h.Close)
+	return h
+}
+
+//Publish publish a copy of the event to the topic,its ID is set to the hub sequence number,
+//a subscriber whose buffer is full is closed rather than skipped,
+//so the client reconnects and gets the missed events replayed from Last-Event-ID
+func (h *Hub) Publish(topic string, e *SSEvent) error {
+	if e == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return ErrHubClosed
+	}
+	h.seq++
+	c := *e
+	c.ID = strconv.FormatInt(h.seq, 10)
+	he := &hubEvent{seq: h.seq, e: &c}
+	t := h.topic(topic)
+	if h.history > 0 {
+		t.recent = append(t.recent, he)
+		if len(t.recent) > h.history {
+			t.recent = t.recent[len(t.recent)-h.history:]
+		}
+	}
+	for sub := range t.subs {
+		if sub.dropped {
+			continue
+		}
+		select {
+		case sub.ch <- he:
+		default:
+			//slow subscriber,close it rather than block the publisher or lose the event silently
+			sub.dropped = true
+			close(sub.slow)
+			logs.Info("sse subscriber too slow,closed,topic=" + topic + ",event id=" + c.ID)
+		}
+	}
+	return nil
+}
+
+//topic returns the topic,must hold the lock
+func (h *Hub) topic(name string) *hubTopic {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &hubTopic{subs: make(map[*hubSub]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+//Subscribe open the SSE stream of ctx and send the events of topics until
+//the client disconnects,the hub is closed or the subscriber is too slow(ErrSlowSubscriber),
+//the kept events of the topics after Last-Event-ID are replayed first in the publishing order
+//	bast.Get("/events", func(ctx *bast.Context) {
+//		hub.Subscribe(ctx, "jobs")
+//	}).Timeout(-1)
+func (h *Hub) Subscribe(ctx *Context, topics ...string) error {
+	w, err := ctx.SSE()
+	if err != nil {
+		return err
+	}
+	sub := &hubSub{ch: make(chan *hubEvent, 64), slow: make(chan struct{})}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return ErrHubClosed
+	}
+	var replay []*hubEvent
+	last, err := strconv.ParseInt(w.LastEventID(), 10, 64)
+	for _, name := range topics {
+		t := h.topic(name)
+		if _, ok := t.subs[sub]; ok {
+			//the topic is repeated
+			continue
+		}
+		t.subs[sub] = struct{}{}
+		if err == nil {
+			replay = append(replay, eventsAfter(t.recent, last)...)
+		}
+	}
+	h.mu.Unlock()
+	defer h.unsubscribe(sub, topics)
+	sort.Slice(replay, func(i, j int) bool { return replay[i].seq < replay[j].seq })
+	for _, he := range replay {
+		if err := w.Send(he.e); err != nil {
+			return err
+		}
+	}
+	var keepalive <-chan time.Time
+	if h.Keepalive > 0 {
+		t := time.NewTicker(h.Keepalive)
+		defer t.Stop()
+		keepalive = t.C
+	}
+	for {
+		select {
+		case he := <-sub.ch:
+			if err := w.Send(he.e); err != nil {
+				return err
+			}
+		case <-keepalive:
+			if err := w.Comment("keepalive"); err != nil {
+				return err
+			}
+		case <-sub.slow:
+			return ErrSlowSubscriber
+		case <-ctx.Done():
+			return ctx.context().Err()
+		case <-h.done:
+			return ErrHubClosed
+		}
+	}
+}
+
+//eventsAfter returns the events after the sequence number
+func eventsAfter(recent []*hubEvent, seq int64) []*hubEvent {
+	i := sort.Search(len(recent), func(i int) bool { return recent[i].seq > seq })
+	return recent[i:]
+}
+
+//unsubscribe remove the subscriber
+func (h *Hub) unsubscribe(sub *hubSub, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, name := range topics {
+		if t, ok := h.topics[name]; ok {
+			delete(t.subs, sub)
+			if len(t.subs) == 0 && len(t.recent) == 0 {
+				delete(h.topics, name)
+			}
+		}
+	}
+}
+
+//Subscribers returns the number of subscribers of the topic
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if t, ok := h.topics[topic]; ok {
+		return len(t.subs)
+	}
+	return 0
+}
+
+//Close close the hub and all subscribed streams
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+}
@@ -0,0 +1,92 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHubReplay(t *testing.T) {
+	hub := NewHub(10)
+	defer hub.Close()
+	e := &SSEvent{Data: "a1"}
+	hub.Publish("a", e)
+	if e.ID != "" {
+		t.Fatal("the event of the caller is changed,id=" + e.ID)
+	}
+	hub.Publish("b", &SSEvent{Data: "b1"})
+	hub.Publish("a", &SSEvent{Data: "a2"})
+	hub.Publish("c", &SSEvent{Data: "c1"})
+	hub.Publish("b", &SSEvent{Data: "b2"})
+	r := newTestRoute(func(ctx *Context) {
+		hub.Subscribe(ctx, strings.Split(ctx.Request.URL.Query().Get("topics"), ",")...)
+	})
+	r.timeout = -1
+	srv := serveRoute(t, r)
+
+	tests := []struct {
+		topics, last string
+		want         []string
+	}{
+		{"a,b", "1", []string{"2:b1", "3:a2", "5:b2"}},
+		{"b,a,a", "0", []string{"1:a1", "2:b1", "3:a2", "5:b2"}},
+		{"c", "4", nil},
+		{"a", "", nil},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", srv.URL+"/test?topics="+tt.topics, nil)
+		if tt.last != "" {
+			req.Header.Set("Last-Event-ID", tt.last)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//a live event ends the replay
+		hub.Publish(strings.Split(tt.topics, ",")[0], &SSEvent{Data: "live"})
+		var got []string
+		id := ""
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			line := s.Text()
+			if strings.HasPrefix(line, "id: ") {
+				id = line[4:]
+			} else if strings.HasPrefix(line, "data: ") {
+				if line[6:] == "live" {
+					break
+				}
+				got = append(got, id+":"+line[6:])
+			}
+		}
+		res.Body.Close()
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("topics %s after %s: got %v,want %v", tt.topics, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	hub := NewHub(0)
+	defer hub.Close()
+	sub := &hubSub{ch: make(chan *hubEvent, 1), slow: make(chan struct{})}
+	hub.mu.Lock()
+	hub.topic("a").subs[sub] = struct{}{}
+	hub.mu.Unlock()
+	hub.Publish("a", &SSEvent{Data: 1})
+	select {
+	case <-sub.slow:
+		t.Fatal("closed before the buffer is full")
+	default:
+	}
+	hub.Publish("a", &SSEvent{Data: 2})
+	select {
+	case <-sub.slow:
+	default:
+		t.Fatal("the slow subscriber is not closed")
+	}
+	//the later events don't panic on the closed subscriber
+	hub.Publish("a", &SSEvent{Data: 3})
+}
@@ -0,0 +1,192 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"go.uber.org/zap"
+)
+
+var (
+	//StreamFlushRows flush the stream every n rows
+	StreamFlushRows = 100
+	//StreamFlushInterval flush the stream at least every interval
+	StreamFlushInterval = time.Second
+)
+
+//stream streaming response writer
+type stream struct {
+	c         *Context
+	kind      string
+	w         *bufio.Writer
+	rows      int
+	pending   int
+	lastFlush time.Time
+}
+
+//newStream set the content type and create the buffered stream
+func (c *Context) newStream(kind, contentType string) *stream {
+	h := c.ResponseWriter.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Content-Type-Options", "nosniff")
+	return &stream{c: c, kind: kind, w: bufio.NewWriterSize(c.ResponseWriter, 32<<10), lastFlush: time.Now()}
+}
+
+//check returns an error if the client has gone or the request has timed out
+func (s *stream) check() error {
+	select {
+	case <-s.c.Done():
+		err := s.c.context().Err()
+		if err == nil {
+			err = errors.New("client disconnected")
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+//row count a row and flush periodically
+func (s *stream) row() error {
+	s.rows++
+	s.pending++
+	if s.pending >= StreamFlushRows || time.Since(s.lastFlush) >= StreamFlushInterval {
+		return s.flush()
+	}
+	return nil
+}
+
+//flush flush the buffered data to the client
+func (s *stream) flush() error {
+	s.pending = 0
+	s.lastFlush = time.Now()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+//finish flush the stream or report the failure
+func (s *stream) finish(err error) error {
+	if err == nil {
+		if err = s.flush(); err == nil {
+			return nil
+		}
+	}
+	req := s.c.Request
+	fields := []zap.Field{
+		zap.String("stream", s.kind),
+		zap.String("uri", req.RequestURI),
+		zap.Int("rows", s.rows),
+		zap.Error(err),
+	}
+	if !written(s.c.ResponseWriter) {
+		//nothing has been sent,reply the standard envelope
+		s.w.Reset(s.c.ResponseWriter)
+		s.c.ResponseWriter.Header().Del("Content-Type")
+		s.c.FailResultWithStatus(http.StatusInternalServerError, "输出数据失败,详情："+err.Error(), SerError)
+		logs.Error("stream failed", fields...)
+		return err
+	}
+	//partial response has been sent,the client sees a truncated body
+	s.flush()
+	logs.Error("stream partial failure", fields...)
+	return err
+}
+
+//StreamJSONArray 以JSON数组格式流式输出,每次调用emit输出一个元素
+//客户端断开或请求超时时emit返回错误,失败时记录已输出的行数
+//param:
+//	f 数据生成函数
+func (c *Context) StreamJSONArray(f func(emit func(v interface{}) error) error) error {
+	s := c.newStream("json", "application/json")
+	enc := json.NewEncoder(s.w)
+	first := true
+	err := f(func(v interface{}) error {
+		if err := s.check(); err != nil {
+			return err
+		}
+		sep := byte(',')
+		if first {
+			sep = '['
+			first = false
+		}
+		if err := s.w.WriteByte(sep); err != nil {
+			return err
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return s.row()
+	})
+	if err == nil {
+		if first {
+			_, err = s.w.WriteString("[]")
+		} else {
+			err = s.w.WriteByte(']')
+		}
+	}
+	return s.finish(err)
+}
+
+//StreamNDJSON 以NDJSON(每行一个JSON)格式流式输出
+//param:
+//	f 数据生成函数
+func (c *Context) StreamNDJSON(f func(emit func(v interface{}) error) error) error {
+	s := c.newStream("ndjson", "application/x-ndjson")
+	enc := json.NewEncoder(s.w)
+	err := f(func(v interface{}) error {
+		if err := s.check(); err != nil {
+			return err
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return s.row()
+	})
+	return s.finish(err)
+}
+
+//StreamCSV 以CSV格式流式输出
+//param:
+//	header 表头,为空则不输出
+//	f 数据生成函数,每次调用emit输出一行
+func (c *Context) StreamCSV(header []string, f func(emit func(row []string) error) error) error {
+	s := c.newStream("csv", "text/csv; charset=utf-8")
+	w := csv.NewWriter(s.w)
+	if len(header) > 0 {
+		if err := w.Write(header); err != nil {
+			return s.finish(err)
+		}
+	}
+	err := f(func(row []string) error {
+		if err := s.check(); err != nil {
+			return err
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		//csv.Writer has its own buffer,push it to the stream buffer
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return s.row()
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	return s.finish(err)
+}
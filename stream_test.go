@@ -0,0 +1,161 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+//setStreamFlushRows set StreamFlushRows,it's restored after the test
+func setStreamFlushRows(t *testing.T, n int) {
+	old := StreamFlushRows
+	StreamFlushRows = n
+	t.Cleanup(func() { StreamFlushRows = old })
+}
+
+//emitRows emit n rows of v(i)
+func emitRows(n int, v func(i int) interface{}) func(emit func(v interface{}) error) error {
+	return func(emit func(v interface{}) error) error {
+		for i := 0; i < n; i++ {
+			if err := emit(v(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestStreamFormats(t *testing.T) {
+	item := func(i int) interface{} { return map[string]int{"id": i} }
+	handlers := map[string]func(ctx *Context){
+		"json":  func(ctx *Context) { ctx.StreamJSONArray(emitRows(3, item)) },
+		"empty": func(ctx *Context) { ctx.StreamJSONArray(emitRows(0, item)) },
+		"ndjson": func(ctx *Context) {
+			ctx.StreamNDJSON(emitRows(2, item))
+		},
+		"csv": func(ctx *Context) {
+			ctx.StreamCSV([]string{"id", "name"}, func(emit func(row []string) error) error {
+				if err := emit([]string{"1", "a,b"}); err != nil {
+					return err
+				}
+				return emit([]string{"2", `say "hi"`})
+			})
+		},
+	}
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		handlers[ctx.GetString("kind")](ctx)
+	}))
+	tests := []struct {
+		kind, contentType, body string
+	}{
+		{"json", "application/json", "[{\"id\":0}\n,{\"id\":1}\n,{\"id\":2}\n]"},
+		{"empty", "application/json", "[]"},
+		{"ndjson", "application/x-ndjson", "{\"id\":0}\n{\"id\":1}\n"},
+		{"csv", "text/csv; charset=utf-8", "id,name\n1,\"a,b\"\n2,\"say \"\"hi\"\"\"\n"},
+	}
+	for _, tt := range tests {
+		res, err := http.Get(srv.URL + "/test?kind=" + tt.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != tt.contentType || string(body) != tt.body {
+			t.Errorf("%s: status=%d type=%q body=%q", tt.kind, res.StatusCode, res.Header.Get("Content-Type"), body)
+		}
+		if tt.kind == "json" {
+			var v []map[string]int
+			if err := json.Unmarshal(body, &v); err != nil || len(v) != 3 {
+				t.Errorf("json array=%v,%v", v, err)
+			}
+		}
+	}
+}
+
+func TestStreamFailure(t *testing.T) {
+	failed := errors.New("query failed")
+	fail := func(n int) func(emit func(v interface{}) error) error {
+		return func(emit func(v interface{}) error) error {
+			if err := emitRows(n, func(i int) interface{} { return i })(emit); err != nil {
+				return err
+			}
+			return failed
+		}
+	}
+	srv := serveRoute(t, newTestRoute(func(ctx *Context) {
+		n := ctx.GetIntVal("rows")
+		if err := ctx.StreamNDJSON(fail(n)); err != failed {
+			t.Errorf("rows=%d: err=%v", n, err)
+		}
+	}))
+	setStreamFlushRows(t, 2)
+
+	//nothing is sent,the standard envelope
+	res, err := http.Get(srv.URL + "/test?rows=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Msgs{}
+	json.NewDecoder(res.Body).Decode(msg)
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError || msg.Code != SerError {
+		t.Errorf("status=%d msg=%+v", res.StatusCode, msg)
+	}
+
+	//the flushed rows are kept,the client sees a truncated body
+	res, err = http.Get(srv.URL + "/test?rows=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "0\n1\n2\n" {
+		t.Errorf("status=%d body=%q", res.StatusCode, body)
+	}
+}
+
+func TestStreamClientGone(t *testing.T) {
+	setStreamFlushRows(t, 1)
+	result := make(chan error, 1)
+	r := newTestRoute(func(ctx *Context) {
+		result <- ctx.StreamNDJSON(func(emit func(v interface{}) error) error {
+			for i := 0; ; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	})
+	r.Timeout(-1)
+	srv := serveRoute(t, r)
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL+"/test", nil)
+	res, err := http.DefaultClient.Do(req.WithContext(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the rows are flushed as they are emitted
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil || line != "0\n" {
+		t.Fatalf("first row=%q,%v", line, err)
+	}
+	cancel()
+	res.Body.Close()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("the stream isn't stopped")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the stream isn't stopped after the client has gone")
+	}
+}
@@ -0,0 +1,256 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aixiaoxiang/bast/logs"
+	"github.com/gorilla/websocket"
+)
+
+//websocket message types,see github.com/gorilla/websocket
+const (
+	WSTextMessage   = websocket.TextMessage
+	WSBinaryMessage = websocket.BinaryMessage
+)
+
+//ErrWSClosed the websocket connection has been closed
+var ErrWSClosed = errors.New("websocket closed")
+
+//WSConf websocket config
+type WSConf struct {
+	//ReadLimit max message bytes read from the client,default 64K
+	ReadLimit int64
+	//PingInterval ping interval,default 30s
+	PingInterval time.Duration
+	//PongWait the time to wait for the pong,default PingInterval*2
+	PongWait time.Duration
+	//WriteWait write deadline of a message,default 10s
+	WriteWait time.Duration
+	//ReadBufferSize and WriteBufferSize see websocket.Upgrader
+	ReadBufferSize, WriteBufferSize int
+	//EnableCompression negotiate per message deflate compression
+	EnableCompression bool
+	//Subprotocols the server supported protocols in order of preference
+	Subprotocols []string
+}
+
+//WSConn websocket connection,the write methods are safe for concurrent use
+type WSConn struct {
+	*websocket.Conn
+	conf      *WSConf
+	wmu       sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+//WebSocket registers the websocket handler for the given pattern,
+//the request goes through the same middleware as Get,the Origin must be in AllowOrigins,
+//or the same origin as the request if AllowOrigins is empty,
+//the connection is closed when f returns or the server shuts down
+//	bast.WebSocket("/chat", func(ctx *bast.Context, conn *bast.WSConn) {
+//		for {
+//			var msg Message
+//			if err := conn.ReadJSON(&msg); err != nil {
+//				return
+//			}
+//			conn.WriteJSON(&msg)
+//		}
+//	})
+func WebSocket(pattern string, f func(ctx *Context, conn *WSConn), conf ...*WSConf) *Route {
+	c := &WSConf{}
+	if len(conf) > 0 && conf[0] != nil {
+		*c = *conf[0]
+	}
+	if c.ReadLimit <= 0 {
+		c.ReadLimit = 64 << 10
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = 30 * time.Second
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = c.PingInterval * 2
+	}
+	if c.WriteWait <= 0 {
+		c.WriteWait = 10 * time.Second
+	}
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:    c.ReadBufferSize,
+		WriteBufferSize:   c.WriteBufferSize,
+		EnableCompression: c.EnableCompression,
+		Subprotocols:      c.Subprotocols,
+		CheckOrigin:       wsCheckOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			writeFail(w, status, "websocket握手失败,详情："+reason.Error(), SerError)
+		},
+	}
+	r := doHandle("GET", pattern, func(ctx *Context) {
+		conn, err := upgrader.Upgrade(ctx.ResponseWriter, ctx.Request, nil)
+		if err != nil {
+			logs.Info("websocket upgrade error=" + err.Error())
+			return
+		}
+		wc := newWSConn(conn, c)
+		defer wc.Close()
+		f(ctx, wc)
+	})
+	//the connection is hijacked,the handler deadline doesn't apply
+	r.timeout = -1
+	return r
+}
+
+//wsCheckOrigin allows the requests without Origin(non-browser clients) and the origins of AllowOrigins,
+//the origin host must equal the request host if AllowOrigins is empty
+func wsCheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(app.origins()) > 0 {
+		return allowOrigin(origin)
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+//newWSConn create the connection and start the keepalive
+func newWSConn(conn *websocket.Conn, conf *WSConf) *WSConn {
+	c := &WSConn{Conn: conn, conf: conf, done: make(chan struct{})}
+	conn.SetReadLimit(conf.ReadLimit)
+	conn.SetReadDeadline(time.Now().Add(conf.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(conf.PongWait))
+	})
+	wsConns.add(c)
+	go c.keepalive()
+	return c
+}
+
+//keepalive send ping until closed
+func (c *WSConn) keepalive() {
+	t := time.NewTicker(c.conf.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.conf.WriteWait)); err != nil {
+				c.Conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+//WriteMessage write the message with the write deadline
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.done:
+		return ErrWSClosed
+	default:
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(c.conf.WriteWait))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+//WriteJSON write the JSON encoding of v as a text message
+func (c *WSConn) WriteJSON(v interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.done:
+		return ErrWSClosed
+	default:
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(c.conf.WriteWait))
+	return c.Conn.WriteJSON(v)
+}
+
+//WriteText write a text message
+func (c *WSConn) WriteText(text string) error {
+	return c.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+//ReadText read a text message
+func (c *WSConn) ReadText() (string, error) {
+	_, data, err := c.Conn.ReadMessage()
+	return string(data), err
+}
+
+//Done returns a channel that's closed when the connection is closed
+func (c *WSConn) Done() <-chan struct{} {
+	return c.done
+}
+
+//Close send the normal close frame and close the connection
+func (c *WSConn) Close() error {
+	return c.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+//CloseWith send the close frame with code and text and close the connection
+func (c *WSConn) CloseWith(code int, text string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.wmu.Lock()
+		close(c.done)
+		c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(c.conf.WriteWait))
+		err = c.Conn.Close()
+		c.wmu.Unlock()
+		wsConns.remove(c)
+	})
+	return err
+}
+
+//IsWSCloseError returns true if err is a normal websocket close error
+func IsWSCloseError(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived)
+}
+
+//wsConnSet the open connections,closed when the server shuts down
+type wsConnSet struct {
+	mu    sync.Mutex
+	once  sync.Once
+	conns map[*WSConn]struct{}
+}
+
+var wsConns = &wsConnSet{conns: make(map[*WSConn]struct{})}
+
+func (s *wsConnSet) add(c *WSConn) {
+	s.once.Do(func() {
+		app.Server.RegisterOnShutdown(s.closeAll)
+	})
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *wsConnSet) remove(c *WSConn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+//closeAll close all connections with going away
+func (s *wsConnSet) closeAll() {
+	s.mu.Lock()
+	conns := make([]*WSConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.CloseWith(websocket.CloseGoingAway, "server shutdown")
+	}
+}
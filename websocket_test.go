@@ -0,0 +1,89 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSCheckOrigin(t *testing.T) {
+	tests := []struct {
+		allow  []string
+		origin string
+		want   bool
+	}{
+		{nil, "", true},
+		{nil, "http://example.com", true},
+		{nil, "https://EXAMPLE.com", true},
+		{nil, "http://evil.com", false},
+		{nil, "http://example.com.evil.com", false},
+		{nil, "http://example.com:8080", false},
+		{nil, "::bad", false},
+		{[]string{"https://app.example.org"}, "https://app.example.org", true},
+		{[]string{"https://app.example.org"}, "http://example.com", false},
+		{[]string{"*.example.org"}, "https://a.example.org", true},
+	}
+	for _, tt := range tests {
+		setTestOrigins(t, tt.allow...)
+		r := httptest.NewRequest("GET", "http://example.com/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := wsCheckOrigin(r); got != tt.want {
+			t.Errorf("allow=%v,origin=%q: got %v,want %v", tt.allow, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	setTestOrigins(t)
+	srv := setTestRouter(t)
+	closed := make(chan struct{})
+	WebSocket("/ws", func(ctx *Context, conn *WSConn) {
+		defer close(closed)
+		for {
+			text, err := conn.ReadText()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteText("echo:" + text); err != nil {
+				return
+			}
+		}
+	})
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	//a cross-origin handshake is rejected
+	header := http.Header{"Origin": {"http://evil.com"}}
+	if _, res, err := websocket.DefaultDialer.Dial(wsURL, header); err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross-origin handshake:%v", err)
+	}
+
+	header = http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "echo:hi" {
+		t.Fatalf("echo=%q,%v", data, err)
+	}
+
+	//the handler returns after the client closes
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the handler isn't returned after the close")
+	}
+}
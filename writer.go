@@ -0,0 +1,229 @@
+//Copyright 2018 The axx Authors. All rights reserved.
+
+package bast
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//responseWriter wrap http.ResponseWriter,record status and size,
+//and stop writing after the handler timed out
+type responseWriter struct {
+	http.ResponseWriter
+	//header is copied to the original header when the header is written,
+	//so a timed out handler can't race with the timeout response
+	header      http.Header
+	mu          sync.Mutex
+	status      int
+	size        int64
+	wroteHeader bool
+	timedOut    bool
+	hijacked    bool
+	aborted     bool
+}
+
+//errAborted the response has been replaced by an error response,see abort
+var errAborted = errors.New("the response has been aborted")
+
+//reset reset the writer for the next request
+func (w *responseWriter) reset(rw http.ResponseWriter) {
+	w.ResponseWriter = rw
+	w.header = nil
+	w.status = 0
+	w.size = 0
+	w.wroteHeader = false
+	w.timedOut = false
+	w.hijacked = false
+	w.aborted = false
+}
+
+//Header see http.ResponseWriter Header
+func (w *responseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+//writeHeader copy the header and write the status code,must hold the lock
+func (w *responseWriter) writeHeader(code int) {
+	w.wroteHeader = true
+	w.status = code
+	if w.header != nil {
+		h := w.ResponseWriter.Header()
+		for k, v := range w.header {
+			h[k] = v
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+//WriteHeader see http.ResponseWriter WriteHeader
+func (w *responseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.writeHeader(code)
+}
+
+//Write see http.ResponseWriter Write
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.aborted {
+		return 0, errAborted
+	}
+	if !w.wroteHeader {
+		w.writeHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+//finish write the header if the handler wrote nothing,
+//so the headers it set are sent
+func (w *responseWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wroteHeader || w.timedOut || w.hijacked {
+		return
+	}
+	w.writeHeader(http.StatusOK)
+}
+
+//Flush see http.Flusher
+func (w *responseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.aborted {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.writeHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+//Hijack see http.Hijacker
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+		if !w.wroteHeader {
+			w.wroteHeader = true
+			w.status = http.StatusSwitchingProtocols
+		}
+	}
+	return conn, rw, err
+}
+
+//Unwrap returns the original http.ResponseWriter,see http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//Status returns the response status code,0 if nothing has been written
+func (w *responseWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+//Size returns the number of body bytes written
+func (w *responseWriter) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+//Written returns true if the header has been written
+func (w *responseWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wroteHeader
+}
+
+//timeout mark the writer timed out,f is called to write the timeout response
+//only if nothing has been written yet
+func (w *responseWriter) timeout(f func(rw http.ResponseWriter)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.hijacked {
+		return
+	}
+	if !w.wroteHeader && f != nil {
+		w.wroteHeader = true
+		w.status = http.StatusServiceUnavailable
+		f(w.ResponseWriter)
+	}
+	w.timedOut = true
+}
+
+//abort write the error response with f if nothing has been written,
+//the later writes of the handler are dropped,the headers set before are kept except the body ones
+func (w *responseWriter) abort(status int, f func(rw http.ResponseWriter)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.hijacked || w.aborted {
+		return
+	}
+	if !w.wroteHeader {
+		if w.header != nil {
+			h := w.ResponseWriter.Header()
+			for k, v := range w.header {
+				h[k] = v
+			}
+			for _, k := range []string{"Content-Encoding", "Content-Length", "ETag"} {
+				h.Del(k)
+			}
+		}
+		w.wroteHeader = true
+		w.status = status
+		f(w.ResponseWriter)
+	}
+	w.aborted = true
+}
+
+//deadliner http.ResponseWriter that supports per-request read/write deadlines(go1.20+)
+type deadliner interface {
+	SetReadDeadline(deadline time.Time) error
+	SetWriteDeadline(deadline time.Time) error
+}
+
+//setDeadline set the connection read/write deadline of the current request,
+//ignored when the ResponseWriter doesn't support it
+func setDeadline(w http.ResponseWriter, read, write time.Duration) {
+	if read <= 0 && write <= 0 {
+		return
+	}
+	d, ok := w.(deadliner)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if read > 0 {
+		d.SetReadDeadline(now.Add(read))
+	}
+	if write > 0 {
+		d.SetWriteDeadline(now.Add(write))
+	}
+}